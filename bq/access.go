@@ -0,0 +1,134 @@
+package bq
+
+import (
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+
+	"github.com/cockscomb/cel2sql"
+)
+
+// FieldAccess describes a reference to a field of a BigQuery table.
+type FieldAccess struct {
+	// Path is the path of the field from the variable, like ["user", "email"],
+	// or from the message type of a related table, like ["Employee", "email"].
+	Path        []string
+	PolicyTags  []string
+	Description string
+}
+
+// AccessPolicy decides whether principal may reference the field.
+// It returns an error to deny the reference, or a non-empty SQL expression to mask the field, e.g. "NULL".
+type AccessPolicy func(principal interface{}, field FieldAccess) (string, error)
+
+// AccessController enforces column-level access control based on the policy tags of BigQuery schemas.
+type AccessController struct {
+	schemas        map[string]bigquery.Schema
+	relatedSchemas map[string]bigquery.Schema
+	principal      interface{}
+	policy         AccessPolicy
+}
+
+type AccessControllerOption func(*AccessController)
+
+// WithRelatedSchemas gives the schemas of the tables related by cel2sql.Relationships, keyed by their message types.
+// Without the schema of a related table, every access to it is denied.
+func WithRelatedSchemas(schemas map[string]bigquery.Schema) AccessControllerOption {
+	return func(c *AccessController) {
+		c.relatedSchemas = schemas
+	}
+}
+
+// NewAccessController creates an AccessController for principal.
+// schemas are keyed by the names of the CEL variables, rather than the type names given to NewTypeProvider.
+func NewAccessController(schemas map[string]bigquery.Schema, principal interface{}, policy AccessPolicy, opts ...AccessControllerOption) *AccessController {
+	c := &AccessController{schemas: schemas, principal: principal, policy: policy}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *AccessController) AuthorizeIdentAccess(rootExpr *exprpb.Expr, path []string) (string, error) {
+	if rootExpr != nil {
+		// the fields of the root expression have been authorized
+		return "", nil
+	}
+	schema, found := c.schemas[path[0]]
+	if !found {
+		return "", nil
+	}
+	return c.authorize(schema, path)
+}
+
+// AuthorizeRelatedAccess authorizes path of a row of the related table by the schema of its message type.
+func (c *AccessController) AuthorizeRelatedAccess(rel cel2sql.Relationship, path []string) (string, error) {
+	schema, found := c.relatedSchemas[rel.Type]
+	if !found {
+		return "", fmt.Errorf("cannot authorize the access to %s without the schema of %q", rel.Table, rel.Type)
+	}
+	return c.authorize(schema, append([]string{rel.Type}, path...))
+}
+
+// authorize authorizes the fields of path, whose root path[0] has schema.
+func (c *AccessController) authorize(schema bigquery.Schema, path []string) (string, error) {
+	for i, name := range path[1:] {
+		field := findField(schema, name)
+		if field == nil {
+			// not a column, e.g. a key of a JSON value
+			break
+		}
+		masked, err := c.policy(c.principal, newFieldAccess(path[:i+2], field))
+		if err != nil {
+			return "", err
+		}
+		if masked != "" {
+			if i+2 < len(path) {
+				return "", fmt.Errorf("cannot select %q from masked field %q", strings.Join(path, "."), strings.Join(path[:i+2], "."))
+			}
+			return masked, nil
+		}
+		schema = field.Schema
+	}
+	// referencing a record exposes all of its fields
+	return "", c.authorizeDescendants(path, schema)
+}
+
+func (c *AccessController) authorizeDescendants(path []string, schema bigquery.Schema) error {
+	for _, field := range schema {
+		fieldPath := append(path[:len(path):len(path)], field.Name)
+		masked, err := c.policy(c.principal, newFieldAccess(fieldPath, field))
+		if err != nil {
+			return err
+		}
+		if masked != "" {
+			return fmt.Errorf("cannot reference %q containing masked field %q", strings.Join(path, "."), strings.Join(fieldPath, "."))
+		}
+		if err := c.authorizeDescendants(fieldPath, field.Schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findField(schema bigquery.Schema, name string) *bigquery.FieldSchema {
+	for _, field := range schema {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+func newFieldAccess(path []string, field *bigquery.FieldSchema) FieldAccess {
+	access := FieldAccess{Path: append([]string{}, path...), Description: field.Description}
+	if field.PolicyTags != nil {
+		access.PolicyTags = field.PolicyTags.Names
+	}
+	return access
+}
+
+var _ cel2sql.IdentAuthorizer = new(AccessController)
+var _ cel2sql.RelatedIdentAuthorizer = new(AccessController)
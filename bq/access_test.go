@@ -0,0 +1,350 @@
+package bq_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockscomb/cel2sql"
+	"github.com/cockscomb/cel2sql/bq"
+)
+
+func TestAccessController(t *testing.T) {
+	userSchema := bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "email", Type: bigquery.StringFieldType, PolicyTags: &bigquery.PolicyTagList{Names: []string{"pii"}}},
+		{Name: "phone", Type: bigquery.StringFieldType, PolicyTags: &bigquery.PolicyTagList{Names: []string{"masked"}}},
+		{Name: "contacts", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType},
+			{Name: "email", Type: bigquery.StringFieldType, PolicyTags: &bigquery.PolicyTagList{Names: []string{"pii"}}},
+		}},
+	}
+	env, err := cel.NewEnv(
+		cel.EnableMacroCallTracking(),
+		cel.CustomTypeProvider(bq.NewTypeProvider(map[string]bigquery.Schema{
+			"User": userSchema,
+		})),
+		cel.Declarations(
+			decls.NewVar("user", decls.NewObjectType("User")),
+		),
+	)
+	require.NoError(t, err)
+
+	policy := func(principal interface{}, field bq.FieldAccess) (string, error) {
+		for _, tag := range field.PolicyTags {
+			switch tag {
+			case "pii":
+				if principal != "admin" {
+					return "", errors.New("access denied to " + strings.Join(field.Path, "."))
+				}
+			case "masked":
+				return "NULL", nil
+			}
+		}
+		return "", nil
+	}
+	tests := []struct {
+		name      string
+		source    string
+		principal string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "allowed",
+			source:    `user.name == "a"`,
+			principal: "analyst",
+			want:      "`user`.`name` = \"a\"",
+		},
+		{
+			name:      "denied",
+			source:    `user.email == "a"`,
+			principal: "analyst",
+			wantErr:   true,
+		},
+		{
+			name:      "admin",
+			source:    `user.email == "a"`,
+			principal: "admin",
+			want:      "`user`.`email` = \"a\"",
+		},
+		{
+			name:      "masked",
+			source:    `has(user.phone)`,
+			principal: "admin",
+			want:      "NULL IS NOT NULL",
+		},
+		{
+			name:      "indirect",
+			source:    `user.contacts.exists(c, c.name == "a")`,
+			principal: "analyst",
+			wantErr:   true,
+		},
+		{
+			name:      "indirect_admin",
+			source:    `user.contacts.exists(c, c.name == "a")`,
+			principal: "admin",
+			want:      "EXISTS (SELECT * FROM UNNEST(`user`.`contacts`) AS c WHERE `c`.`name` = \"a\")",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ast, issues := env.Compile(tt.source)
+			require.Empty(t, issues)
+			controller := bq.NewAccessController(map[string]bigquery.Schema{"user": userSchema}, tt.principal, policy)
+			got, err := cel2sql.Convert(ast, cel2sql.WithIdentAuthorizer(controller))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAccessController_FieldMapping(t *testing.T) {
+	schemas := map[string]bigquery.Schema{
+		"Event": {
+			{Name: "url", Type: bigquery.StringFieldType},
+			{Name: "display_name", Type: bigquery.StringFieldType, PolicyTags: &bigquery.PolicyTagList{Names: []string{"masked"}}},
+			{Name: "owner_email", Type: bigquery.StringFieldType, PolicyTags: &bigquery.PolicyTagList{Names: []string{"pii"}}},
+		},
+	}
+	mapping := cel2sql.FieldMapping{
+		"Event": {
+			"domain":       {SQL: "NET.REG_DOMAIN(`url`)", Type: decls.String, Columns: []string{"url"}},
+			"name":         {SQL: "`display_name`", Type: decls.String, Columns: []string{"display_name"}},
+			"owner_domain": {SQL: "NET.REG_DOMAIN(`owner_email`)", Type: decls.String, Columns: []string{"owner_email"}},
+			"host":         {SQL: "NET.HOST(`url`)", Type: decls.String},
+		},
+	}
+	env, err := cel.NewEnv(
+		cel.CustomTypeProvider(bq.NewTypeProvider(schemas, bq.WithFieldMapping(mapping))),
+		cel.Declarations(
+			decls.NewVar("event", decls.NewObjectType("Event")),
+		),
+	)
+	require.NoError(t, err)
+
+	policy := func(principal interface{}, field bq.FieldAccess) (string, error) {
+		for _, tag := range field.PolicyTags {
+			switch tag {
+			case "pii":
+				return "", errors.New("access denied to " + strings.Join(field.Path, "."))
+			case "masked":
+				return "NULL", nil
+			}
+		}
+		return "", nil
+	}
+	tests := []struct {
+		name    string
+		source  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "allowed",
+			source: `event.domain == "example.com"`,
+			want:   "(NET.REG_DOMAIN(`url`)) = \"example.com\"",
+		},
+		{
+			name:    "denied",
+			source:  `event.owner_domain == "example.com"`,
+			wantErr: true,
+		},
+		{
+			name:   "masked",
+			source: `event.name == "a"`,
+			want:   "NULL = \"a\"",
+		},
+		{
+			// without Columns, the whole record is authorized
+			name:    "unknown_columns",
+			source:  `event.host == "example.com"`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ast, issues := env.Compile(tt.source)
+			require.Empty(t, issues)
+			got, err := cel2sql.Convert(ast,
+				cel2sql.WithFieldMapping(mapping),
+				cel2sql.WithIdentAuthorizer(bq.NewAccessController(map[string]bigquery.Schema{"event": schemas["Event"]}, nil, policy)))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+// identAuthorizer hides AuthorizeRelatedAccess of the AccessController.
+type identAuthorizer struct {
+	cel2sql.IdentAuthorizer
+}
+
+func TestAccessController_Relationships(t *testing.T) {
+	schemas := map[string]bigquery.Schema{
+		"Employee": {
+			{Name: "id", Type: bigquery.IntegerFieldType},
+			{Name: "name", Type: bigquery.StringFieldType},
+			{Name: "email", Type: bigquery.StringFieldType, PolicyTags: &bigquery.PolicyTagList{Names: []string{"pii"}}},
+			{Name: "phone", Type: bigquery.StringFieldType, PolicyTags: &bigquery.PolicyTagList{Names: []string{"masked"}}},
+			{Name: "manager_id", Type: bigquery.IntegerFieldType},
+		},
+		"Device": {
+			{Name: "employee_id", Type: bigquery.IntegerFieldType},
+			{Name: "os", Type: bigquery.StringFieldType},
+			{Name: "serial", Type: bigquery.StringFieldType, PolicyTags: &bigquery.PolicyTagList{Names: []string{"pii"}}},
+		},
+	}
+	relationships := cel2sql.Relationships{
+		"Employee": {
+			"manager": {Table: "`employees`", Type: "Employee", LocalKey: "manager_id", ForeignKey: "id"},
+			"devices": {Table: "`devices`", Type: "Device", LocalKey: "id", ForeignKey: "employee_id", Many: true},
+		},
+	}
+	mapping := cel2sql.FieldMapping{
+		"Employee": {
+			"display":   {SQL: "UPPER(`name`)", Type: decls.String, Columns: []string{"name"}},
+			"contact":   {SQL: "COALESCE(`phone`, `name`)", Type: decls.String, Columns: []string{"phone", "name"}},
+			"mail_host": {SQL: "SPLIT(`email`, '@')[SAFE_OFFSET(1)]", Type: decls.String, Columns: []string{"email"}},
+		},
+	}
+	env, err := cel.NewEnv(
+		cel.EnableMacroCallTracking(),
+		cel.CustomTypeProvider(bq.NewTypeProvider(schemas, bq.WithRelationships(relationships), bq.WithFieldMapping(mapping))),
+		cel.Declarations(
+			decls.NewVar("employee", decls.NewObjectType("Employee")),
+		),
+	)
+	require.NoError(t, err)
+
+	policy := func(principal interface{}, field bq.FieldAccess) (string, error) {
+		for _, tag := range field.PolicyTags {
+			switch tag {
+			case "pii":
+				return "", errors.New("access denied to " + strings.Join(field.Path, "."))
+			case "masked":
+				return "NULL", nil
+			}
+		}
+		return "", nil
+	}
+	controller := bq.NewAccessController(map[string]bigquery.Schema{"employee": schemas["Employee"]}, nil, policy,
+		bq.WithRelatedSchemas(schemas))
+	tests := []struct {
+		name       string
+		source     string
+		authorizer cel2sql.IdentAuthorizer
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "related_field",
+			source:     `employee.manager.name == "x"`,
+			authorizer: controller,
+			want:       "(SELECT _r0.`name` FROM `employees` AS _r0 WHERE _r0.`id` = `employee`.`manager_id`) = \"x\"",
+		},
+		{
+			name:       "related_field_denied",
+			source:     `employee.manager.email == "x"`,
+			authorizer: controller,
+			wantErr:    true,
+		},
+		{
+			name:       "related_field_masked",
+			source:     `employee.manager.phone == "x"`,
+			authorizer: controller,
+			want:       "(SELECT NULL FROM `employees` AS _r0 WHERE _r0.`id` = `employee`.`manager_id`) = \"x\"",
+		},
+		{
+			name:       "related_mapped_field",
+			source:     `employee.manager.display == "x"`,
+			authorizer: controller,
+			want:       "(SELECT (UPPER(`name`)) FROM `employees` AS _r0 WHERE _r0.`id` = `employee`.`manager_id`) = \"x\"",
+		},
+		{
+			name:       "related_mapped_field_denied",
+			source:     `employee.manager.mail_host == "x"`,
+			authorizer: controller,
+			wantErr:    true,
+		},
+		{
+			name:       "related_mapped_field_masked",
+			source:     `employee.manager.contact == "x"`,
+			authorizer: controller,
+			want:       "(SELECT NULL FROM `employees` AS _r0 WHERE _r0.`id` = `employee`.`manager_id`) = \"x\"",
+		},
+		{
+			name:       "exists",
+			source:     `employee.devices.exists(d, d.os == "mac")`,
+			authorizer: controller,
+			want:       "EXISTS (SELECT * FROM `devices` AS d WHERE d.`employee_id` = `employee`.`id` AND `d`.`os` = \"mac\")",
+		},
+		{
+			name:       "exists_denied",
+			source:     `employee.devices.exists(d, d.serial == "x")`,
+			authorizer: controller,
+			wantErr:    true,
+		},
+		{
+			name:       "all_denied",
+			source:     `employee.devices.all(d, d.serial == "x")`,
+			authorizer: controller,
+			wantErr:    true,
+		},
+		{
+			name:       "map_denied",
+			source:     `"x" in employee.devices.map(d, d.serial)`,
+			authorizer: controller,
+			wantErr:    true,
+		},
+		{
+			name:       "filter_rows_denied",
+			source:     `size(employee.devices.filter(d, d.os == "mac")) > 0`,
+			authorizer: controller,
+			wantErr:    true,
+		},
+		{
+			name:       "related_rows_denied",
+			source:     `has(employee.manager)`,
+			authorizer: controller,
+			wantErr:    true,
+		},
+		{
+			name:       "without_related_authorization",
+			source:     `employee.manager.name == "x"`,
+			authorizer: identAuthorizer{controller},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ast, issues := env.Compile(tt.source)
+			require.Empty(t, issues)
+			got, err := cel2sql.Convert(ast, cel2sql.WithRelationships(relationships), cel2sql.WithFieldMapping(mapping),
+				cel2sql.WithIdentAuthorizer(tt.authorizer))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
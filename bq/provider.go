@@ -9,15 +9,40 @@ import (
 	"github.com/google/cel-go/common/types/ref"
 	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
 
+	"github.com/cockscomb/cel2sql"
 	"github.com/cockscomb/cel2sql/sqltypes"
 )
 
 type typeProvider struct {
-	schemas map[string]bigquery.Schema
+	schemas       map[string]bigquery.Schema
+	fieldMapping  cel2sql.FieldMapping
+	relationships cel2sql.Relationships
 }
 
-func NewTypeProvider(schemas map[string]bigquery.Schema) *typeProvider {
-	return &typeProvider{schemas: schemas}
+type TypeProviderOption func(*typeProvider)
+
+// WithFieldMapping exposes the mapped fields of cel2sql.FieldMapping with their declared types,
+// which may be virtual fields absent from the schemas.
+func WithFieldMapping(mapping cel2sql.FieldMapping) TypeProviderOption {
+	return func(p *typeProvider) {
+		p.fieldMapping = mapping
+	}
+}
+
+// WithRelationships exposes the fields of cel2sql.Relationships as the message types of the related tables,
+// or lists of them for one-to-many relationships.
+func WithRelationships(relationships cel2sql.Relationships) TypeProviderOption {
+	return func(p *typeProvider) {
+		p.relationships = relationships
+	}
+}
+
+func NewTypeProvider(schemas map[string]bigquery.Schema, opts ...TypeProviderOption) *typeProvider {
+	p := &typeProvider{schemas: schemas}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 func (p *typeProvider) EnumValue(enumName string) ref.Val {
@@ -59,6 +84,24 @@ func (p *typeProvider) FindType(typeName string) (*exprpb.Type, bool) {
 }
 
 func (p *typeProvider) FindFieldType(messageType string, fieldName string) (*ref.FieldType, bool) {
+	if mapped, ok := p.fieldMapping.Lookup(messageType, fieldName); ok && mapped.Type != nil {
+		if _, found := p.findSchema(messageType); found {
+			return &ref.FieldType{
+				Type: mapped.Type,
+			}, true
+		}
+	}
+	if rel, ok := p.relationships.Lookup(messageType, fieldName); ok {
+		if _, found := p.findSchema(messageType); found {
+			typ := decls.NewObjectType(rel.Type)
+			if rel.Many {
+				typ = decls.NewListType(typ)
+			}
+			return &ref.FieldType{
+				Type: typ,
+			}, true
+		}
+	}
 	schema, found := p.findSchema(messageType)
 	if !found {
 		return nil, false
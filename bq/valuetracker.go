@@ -2,13 +2,20 @@ package bq
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"reflect"
 
 	"cloud.google.com/go/bigquery"
+	"github.com/google/cel-go/checker/decls"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+
+	"github.com/cockscomb/cel2sql"
 )
 
 type BigQueryNamedTracker struct {
 	Values []bigquery.QueryParameter
+	names  map[interface{}]string
 }
 
 func NewBigQueryNamedTracker() *BigQueryNamedTracker {
@@ -20,12 +27,127 @@ func (t *BigQueryNamedTracker) AddValue(val interface{}) string {
 		// NULL cannot be passed as a parameter
 		return "NULL"
 	}
-	for _, v := range t.Values {
-		if reflect.DeepEqual(v.Value, val) {
-			return "@" + v.Name
-		}
+	if list, ok := val.([]interface{}); ok {
+		val = typedSlice(encodeUints(list))
+	} else {
+		val = encodeUint(val)
+	}
+	if t.names == nil {
+		t.names = make(map[interface{}]string)
+	}
+	key := cel2sql.ValueKey(val)
+	if name, ok := t.names[key]; ok {
+		return "@" + name
 	}
 	name := fmt.Sprintf("v%dt", len(t.Values))
 	t.Values = append(t.Values, bigquery.QueryParameter{Name: name, Value: val})
+	t.names[key] = name
 	return "@" + name
 }
+
+// encodeUint converts a uint64, which the BigQuery client rejects, into an INT64,
+// or into a NUMERIC when it is beyond the range of INT64.
+func encodeUint(val interface{}) interface{} {
+	v, ok := val.(uint64)
+	if !ok {
+		return val
+	}
+	if v > math.MaxInt64 {
+		return new(big.Rat).SetUint64(v)
+	}
+	return int64(v)
+}
+
+// encodeUints converts the uint64 elements of list like encodeUint,
+// all into NUMERIC if any of them is beyond the range of INT64, so that the elements keep a single type.
+func encodeUints(list []interface{}) []interface{} {
+	numeric := false
+	for _, elem := range list {
+		if v, ok := elem.(uint64); ok && v > math.MaxInt64 {
+			numeric = true
+		}
+	}
+	encoded := make([]interface{}, len(list))
+	for i, elem := range list {
+		if v, ok := elem.(uint64); ok && numeric {
+			encoded[i] = new(big.Rat).SetUint64(v)
+		} else {
+			encoded[i] = encodeUint(elem)
+		}
+	}
+	return encoded
+}
+
+// typedSlice converts a list into a slice like []string, which the BigQuery client can infer the type of.
+func typedSlice(list []interface{}) interface{} {
+	if len(list) == 0 {
+		return list
+	}
+	elemType := reflect.TypeOf(list[0])
+	if elemType == nil {
+		return list
+	}
+	slice := reflect.MakeSlice(reflect.SliceOf(elemType), len(list), len(list))
+	for i, elem := range list {
+		if reflect.TypeOf(elem) != elemType {
+			return list
+		}
+		slice.Index(i).Set(reflect.ValueOf(elem))
+	}
+	return slice.Interface()
+}
+
+// AddTypedValue binds NULLs and empty lists as parameters of the SQL type corresponding to typ.
+func (t *BigQueryNamedTracker) AddTypedValue(val interface{}, typ *exprpb.Type) string {
+	list, isList := val.([]interface{})
+	if val != nil && (!isList || len(list) > 0) {
+		return t.AddValue(val)
+	}
+	sqlType := standardSQLDataType(typ)
+	if sqlType == nil {
+		if isList {
+			return "[]"
+		}
+		return t.AddValue(val)
+	}
+	param := &bigquery.QueryParameterValue{Type: *sqlType}
+	if isList {
+		param.Value = list
+	} else {
+		// any invalid NullXxx is sent as NULL, while the type is given by Type
+		param.Value = bigquery.NullString{}
+	}
+	return t.AddValue(param)
+}
+
+func standardSQLDataType(typ *exprpb.Type) *bigquery.StandardSQLDataType {
+	if wrapper := typ.GetWrapper(); wrapper != exprpb.Type_PRIMITIVE_TYPE_UNSPECIFIED {
+		typ = decls.NewPrimitiveType(wrapper)
+	}
+	switch typ.GetPrimitive() {
+	case exprpb.Type_BOOL:
+		return &bigquery.StandardSQLDataType{TypeKind: "BOOL"}
+	case exprpb.Type_INT64, exprpb.Type_UINT64:
+		return &bigquery.StandardSQLDataType{TypeKind: "INT64"}
+	case exprpb.Type_DOUBLE:
+		return &bigquery.StandardSQLDataType{TypeKind: "FLOAT64"}
+	case exprpb.Type_STRING:
+		return &bigquery.StandardSQLDataType{TypeKind: "STRING"}
+	case exprpb.Type_BYTES:
+		return &bigquery.StandardSQLDataType{TypeKind: "BYTES"}
+	}
+	if typ.GetWellKnown() == exprpb.Type_TIMESTAMP {
+		return &bigquery.StandardSQLDataType{TypeKind: "TIMESTAMP"}
+	}
+	switch typ.GetAbstractType().GetName() {
+	case "DATE", "DATETIME", "TIME":
+		return &bigquery.StandardSQLDataType{TypeKind: typ.GetAbstractType().GetName()}
+	}
+	if elemType := typ.GetListType().GetElemType(); elemType != nil {
+		if elem := standardSQLDataType(elemType); elem != nil && elem.ArrayElementType == nil {
+			// arrays of arrays are not supported
+			return &bigquery.StandardSQLDataType{TypeKind: "ARRAY", ArrayElementType: elem}
+		}
+	}
+	return nil
+}
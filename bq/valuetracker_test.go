@@ -0,0 +1,77 @@
+package bq_test
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockscomb/cel2sql"
+	"github.com/cockscomb/cel2sql/bq"
+)
+
+func TestBigQueryNamedTracker_AddValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		val       interface{}
+		wantValue interface{}
+	}{
+		{
+			name:      "uint64",
+			val:       uint64(1),
+			wantValue: int64(1),
+		},
+		{
+			name:      "uint64_max_int64",
+			val:       uint64(math.MaxInt64),
+			wantValue: int64(math.MaxInt64),
+		},
+		{
+			name:      "uint64_numeric",
+			val:       uint64(math.MaxUint64),
+			wantValue: new(big.Rat).SetUint64(math.MaxUint64),
+		},
+		{
+			name:      "uint64_list",
+			val:       []interface{}{uint64(1), uint64(2)},
+			wantValue: []int64{1, 2},
+		},
+		{
+			name:      "uint64_list_numeric",
+			val:       []interface{}{uint64(1), uint64(math.MaxUint64)},
+			wantValue: []*big.Rat{big.NewRat(1, 1), new(big.Rat).SetUint64(math.MaxUint64)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := bq.NewBigQueryNamedTracker()
+			assert.Equal(t, "@v0t", tracker.AddValue(tt.val))
+			assert.Equal(t, []bigquery.QueryParameter{{Name: "v0t", Value: tt.wantValue}}, tracker.Values)
+		})
+	}
+}
+
+func TestBigQueryNamedTracker_Uint(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.Declarations(
+			decls.NewVar("count", decls.Uint),
+		),
+	)
+	require.NoError(t, err)
+	ast, issues := env.Compile(`count == 18446744073709551615u || count in [1u, 2u]`)
+	require.Empty(t, issues)
+
+	tracker := bq.NewBigQueryNamedTracker()
+	got, err := cel2sql.Convert(ast, cel2sql.WithValueTracker(tracker))
+	require.NoError(t, err)
+	assert.Equal(t, "`count` = @v0t OR `count` IN UNNEST(@v1t)", got)
+	assert.Equal(t, []bigquery.QueryParameter{
+		{Name: "v0t", Value: new(big.Rat).SetUint64(math.MaxUint64)},
+		{Name: "v1t", Value: []int64{1, 2}},
+	}, tracker.Values)
+}
@@ -2,12 +2,15 @@ package cel2sql
 
 import (
 	"fmt"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"cloud.google.com/go/civil"
 	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
 	"github.com/google/cel-go/common/operators"
 	"github.com/google/cel-go/common/overloads"
 	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
@@ -32,6 +35,10 @@ func Convert(ast *cel.Ast, opts ...ConvertOption) (string, error) {
 	for _, opt := range opts {
 		opt(un)
 	}
+	if un.now != nil {
+		now := un.now.Truncate(un.nowGranularity).UTC()
+		un.now = &now
+	}
 	if err := un.Visit(checkedExpr.Expr); err != nil {
 		return "", err
 	}
@@ -52,12 +59,96 @@ func WithIdentTracker(tracker IdentTracker) ConvertOption {
 	}
 }
 
+// WithTableAlias replaces the root variable with alias, e.g. employee.name is written as `e`.`name`.
+// With an IdentTracker, the alias is looked up by the variable in CEL and replaces the root of the path the tracker
+// returns, so the tracker may rename the fields but not the variable.
+func WithTableAlias(variable string, alias string) ConvertOption {
+	return func(con *Converter) {
+		if con.tableAliases == nil {
+			con.tableAliases = make(map[string]string)
+		}
+		con.tableAliases[variable] = alias
+	}
+}
+
+// WithDefaultTableAlias qualifies the root identifiers without WithTableAlias by alias, e.g. name is written as `t`.`name`.
+// With an IdentTracker, alias qualifies the path the tracker returns.
+func WithDefaultTableAlias(alias string) ConvertOption {
+	return func(con *Converter) {
+		con.defaultTableAlias = alias
+	}
+}
+
+// WithFieldMapping writes the mapped fields of message types as their SQL expressions,
+// which decouples the CEL schema from the layout of tables.
+func WithFieldMapping(mapping FieldMapping) ConvertOption {
+	return func(con *Converter) {
+		con.fieldMapping = mapping
+	}
+}
+
+// WithRelationships converts the fields of relationships into subqueries against the related tables.
+func WithRelationships(relationships Relationships) ConvertOption {
+	return func(con *Converter) {
+		con.relationships = relationships
+	}
+}
+
+// WithIdentAuthorizer authorizes every reference to an identifier before it is written,
+// which can deny the conversion or replace the identifier with a masked expression.
+func WithIdentAuthorizer(authorizer IdentAuthorizer) ConvertOption {
+	return func(con *Converter) {
+		con.identAuthorizer = authorizer
+	}
+}
+
+// WithWarningTracker reports conversions which may not behave as the CEL expression reads,
+// such as implicit coercions between DATE and TIMESTAMP that depend on the time zone.
+func WithWarningTracker(tracker WarningTracker) ConvertOption {
+	return func(con *Converter) {
+		con.warningTracker = tracker
+	}
+}
+
 func WithExtension(ext Extension) ConvertOption {
 	return func(con *Converter) {
 		con.extensions = append(con.extensions, ext)
 	}
 }
 
+// WithNow replaces the current time functions like current_timestamp() with a fixed time,
+// which makes the converted SQL reproducible and cacheable.
+// The time is written through the ValueTracker, so it becomes a single query parameter when tracked.
+func WithNow(now time.Time) ConvertOption {
+	return func(con *Converter) {
+		con.now = &now
+	}
+}
+
+// WithNowGranularity truncates the time given to WithNow to a multiple of granularity,
+// so that conversions within the same period produce identical SQL.
+func WithNowGranularity(granularity time.Duration) ConvertOption {
+	return func(con *Converter) {
+		con.nowGranularity = granularity
+	}
+}
+
+// WithTimeZone sets the time zone used where a TIMESTAMP is interpreted in civil time without an explicit time zone,
+// e.g. by trunc(), date(timestamp), current_date() and getHours().
+func WithTimeZone(timeZone string) ConvertOption {
+	return func(con *Converter) {
+		con.timeZone = timeZone
+	}
+}
+
+// WithStrictIdentifiers rejects any field which is not resolved by the type provider,
+// such as a key of a map or a field of dyn, so that only the columns of the schema can be referenced.
+func WithStrictIdentifiers() ConvertOption {
+	return func(con *Converter) {
+		con.strictIdentifiers = true
+	}
+}
+
 func WithSQLDialect(dialect SQLDialect) ConvertOption {
 	return func(con *Converter) {
 		con.sqlDialect = dialect
@@ -73,6 +164,13 @@ type ValueTracker interface {
 	AddValue(val interface{}) string
 }
 
+// TypedValueTracker is a ValueTracker which also receives the CEL type of each value,
+// so that NULLs and empty lists can be bound as typed parameters.
+type TypedValueTracker interface {
+	ValueTracker
+	AddTypedValue(val interface{}, typ *exprpb.Type) string
+}
+
 type embedTracker struct{}
 
 func (t *embedTracker) AddValue(val interface{}) string {
@@ -98,15 +196,84 @@ func ValueToString(val interface{}) string {
 		return "NULL"
 	case uint64:
 		return strconv.FormatUint(v, 10)
+	case time.Time:
+		return "TIMESTAMP " + strconv.Quote(v.UTC().Format("2006-01-02 15:04:05.999999-07:00"))
+	case civil.Date:
+		return "DATE " + strconv.Quote(v.String())
+	case civil.DateTime:
+		return "DATETIME " + strconv.Quote(v.Date.String()+" "+civilTimeToString(v.Time))
+	case civil.Time:
+		return "TIME " + strconv.Quote(civilTimeToString(v))
 	default:
 		panic("unsupported type")
 	}
 }
 
+// civilTimeToString formats t with at most microsecond precision, which is supported by BigQuery.
+func civilTimeToString(t civil.Time) string {
+	s := fmt.Sprintf("%02d:%02d:%02d", t.Hour, t.Minute, t.Second)
+	if micros := t.Nanosecond / 1000; micros != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%06d", micros), "0")
+	}
+	return s
+}
+
+// valueKey is the key of a value which is not comparable, or a pointer compared by its address.
+// As a distinct type, it never equals the key of a value itself.
+type valueKey struct {
+	typ  string
+	repr string
+}
+
+// ValueKey returns a comparable key of val, which lets trackers deduplicate values with a map.
+func ValueKey(val interface{}) interface{} {
+	if typ := reflect.TypeOf(val); typ == nil || typ.Comparable() && typ.Kind() != reflect.Ptr {
+		return val
+	}
+	return valueKey{typ: fmt.Sprintf("%T", val), repr: fmt.Sprintf("%#v", val)}
+}
+
 type IdentTracker interface {
 	AddIdentAccess(rootExpr *exprpb.Expr, path []string) []string
 }
 
+// FieldMapping maps fields of message types to SQL expressions, keyed by the message type and then the field name,
+// e.g. FieldMapping{"Event": {"domain": {SQL: "NET.REG_DOMAIN(url)", Type: decls.String}}}.
+type FieldMapping map[string]map[string]MappedField
+
+// MappedField is written as SQL instead of the field. SQL is written verbatim, so it must refer to columns as they are
+// in the query. Type declares the CEL type of a virtual field, which type providers like bq.NewTypeProvider expose.
+// Columns lists the fields SQL reads, relative to the message of the mapped field, like "url" or "location.city".
+// The IdentAuthorizer authorizes them instead of the mapped field, or the whole message if Columns is empty.
+type MappedField struct {
+	SQL     string
+	Type    *exprpb.Type
+	Columns []string
+}
+
+func (m FieldMapping) Lookup(messageType string, field string) (MappedField, bool) {
+	f, ok := m[messageType][field]
+	return f, ok
+}
+
+// IdentAuthorizer returns an error to deny the access to path, or a non-empty SQL expression to write instead of it.
+// rootExpr is nil unless path is relative to the result of another expression, whose identifiers are authorized separately.
+type IdentAuthorizer interface {
+	AuthorizeIdentAccess(rootExpr *exprpb.Expr, path []string) (string, error)
+}
+
+// RelatedIdentAuthorizer is an IdentAuthorizer which also authorizes the fields of the tables related by Relationships.
+// path is relative to a row of rel.Table, and empty when the whole row is referenced.
+// With an IdentAuthorizer which is not a RelatedIdentAuthorizer, every access to related tables is denied.
+type RelatedIdentAuthorizer interface {
+	IdentAuthorizer
+	AuthorizeRelatedAccess(rel Relationship, path []string) (string, error)
+}
+
+type WarningTracker interface {
+	AddWarning(expr *exprpb.Expr, message string)
+}
+
 type SQLDialect int
 
 const (
@@ -115,15 +282,30 @@ const (
 )
 
 type Converter struct {
-	str          strings.Builder
-	typeMap      map[int64]*exprpb.Type
-	macroCalls   map[int64]*exprpb.Expr
-	valueTracker ValueTracker
-	identTracker IdentTracker
-	extensions   []Extension
-	compIterVars []string
+	str             strings.Builder
+	typeMap         map[int64]*exprpb.Type
+	macroCalls      map[int64]*exprpb.Expr
+	valueTracker    ValueTracker
+	identTracker    IdentTracker
+	identAuthorizer IdentAuthorizer
+	fieldMapping    FieldMapping
+	warningTracker  WarningTracker
+	extensions      []Extension
+	compIterVars    []string
+	compIterRels    []*Relationship
+
+	tableAliases      map[string]string
+	defaultTableAlias string
+
+	relationships Relationships
+	relationDepth int
+
+	now            *time.Time
+	nowGranularity time.Duration
+	timeZone       string
 
-	sqlDialect SQLDialect
+	sqlDialect        SQLDialect
+	strictIdentifiers bool
 }
 
 func (con *Converter) GetDialect() SQLDialect {
@@ -135,26 +317,110 @@ func (con *Converter) WriteString(s string) (int, error) {
 }
 
 func (con *Converter) WriteIdent(rootExpr *exprpb.Expr, path []string) error {
+	if con.identAuthorizer != nil {
+		// authorize the path in the schema before the IdentTracker renames it
+		masked, err := con.authorizeIdent(rootExpr, path)
+		if err != nil {
+			return err
+		}
+		if masked != "" {
+			if rootExpr != nil {
+				return fmt.Errorf("cannot mask %q selected from an expression", strings.Join(path, "."))
+			}
+			con.str.WriteString(masked)
+			return nil
+		}
+	}
+	// the alias is chosen by the CEL variable, before the IdentTracker renames it
+	alias, hasAlias := "", false
+	qualify := rootExpr == nil && len(path) > 0 && !con.isComprehensionIterVarAccess(path)
+	if qualify {
+		alias, hasAlias = con.tableAliases[path[0]]
+	}
 	if con.identTracker != nil {
 		if !con.isComprehensionIterVarAccess(path) {
 			path = con.identTracker.AddIdentAccess(rootExpr, path)
 		}
 	}
+	if qualify && len(path) > 0 {
+		if hasAlias {
+			path = append([]string{alias}, path[1:]...)
+		} else if con.defaultTableAlias != "" {
+			path = append([]string{con.defaultTableAlias}, path...)
+		}
+	}
 	for i, p := range path {
+		if p == "" {
+			return fmt.Errorf("invalid empty identifier in %q", strings.Join(path, "."))
+		}
 		if i != 0 || rootExpr != nil {
 			con.str.WriteString(".")
 		}
-		con.str.WriteString("`")
-		con.str.WriteString(p)
-		con.str.WriteString("`")
+		con.str.WriteString(con.QuoteIdentifier(p))
 	}
 	return nil
 }
 
+// authorizeIdent authorizes path, where the variables of comprehensions over relationships are rows of the related tables.
+func (con *Converter) authorizeIdent(rootExpr *exprpb.Expr, path []string) (string, error) {
+	if rootExpr == nil && len(path) > 0 {
+		if rel := con.comprehensionIterVarRelationship(path[0]); rel != nil {
+			return con.authorizeRelatedAccess(*rel, path[1:])
+		}
+	}
+	if con.isComprehensionIterVarAccess(path) {
+		return "", nil
+	}
+	return con.identAuthorizer.AuthorizeIdentAccess(rootExpr, path)
+}
+
+// QuoteIdentifier quotes name with backticks, escaping the characters which would end or break the quoting.
+// Both BigQuery and Spanner accept the escape sequences of string literals in quoted identifiers.
+func (con *Converter) QuoteIdentifier(name string) string {
+	var sb strings.Builder
+	sb.WriteByte('`')
+	for _, r := range name {
+		switch r {
+		case '`':
+			sb.WriteString("\\`")
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&sb, `\x%02x`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('`')
+	return sb.String()
+}
+
+func (con *Converter) addWarning(expr *exprpb.Expr, format string, args ...interface{}) {
+	if con.warningTracker != nil {
+		con.warningTracker.AddWarning(expr, fmt.Sprintf(format, args...))
+	}
+}
+
 func (con *Converter) WriteValue(val interface{}) (int, error) {
 	return con.str.WriteString(con.valueTracker.AddValue(val))
 }
 
+// WriteTypedValue writes val of the CEL type typ, which is passed to the TypedValueTracker if available.
+func (con *Converter) WriteTypedValue(val interface{}, typ *exprpb.Type) (int, error) {
+	if tracker, ok := con.valueTracker.(TypedValueTracker); ok {
+		return con.str.WriteString(tracker.AddTypedValue(val, typ))
+	}
+	return con.WriteValue(val)
+}
+
 func (con *Converter) Visit(expr *exprpb.Expr) error {
 	switch expr.ExprKind.(type) {
 	case *exprpb.Expr_CallExpr:
@@ -186,6 +452,11 @@ func (con *Converter) visitCall(expr *exprpb.Expr) error {
 	// index operator
 	case operators.Index:
 		return con.visitCallIndex(expr)
+	// optional field selection and index operators
+	case operators.OptSelect:
+		return con.visitSelect(expr)
+	case operators.OptIndex:
+		return con.visitCallOptIndex(expr)
 	// unary operators
 	case operators.LogicalNot, operators.Negate:
 		return con.visitCallUnary(expr)
@@ -223,9 +494,13 @@ func (con *Converter) visitCallBinary(expr *exprpb.Expr) error {
 	fun := c.GetFunction()
 	args := c.GetArgs()
 	lhs := args[0]
+	rhs := args[1]
+	if fun == operators.Equals || fun == operators.NotEquals {
+		// the macros of sqltypes wrap temporal literals in dyn() to compare them with other types
+		lhs, rhs = unwrapDyn(lhs), unwrapDyn(rhs)
+	}
 	// add parens if the current operator is lower precedence than the lhs expr operator.
 	lhsParen := isComplexOperatorWithRespectTo(fun, lhs)
-	rhs := args[1]
 	// add parens if the current operator is lower precedence than the rhs expr operator,
 	// or the same precedence and the operator is left recursive.
 	rhsParen := isComplexOperatorWithRespectTo(fun, rhs)
@@ -235,6 +510,16 @@ func (con *Converter) visitCallBinary(expr *exprpb.Expr) error {
 		(isTimestampRelatedType(rhsType) && isDurationRelatedType(lhsType)) {
 		return con.callTimestampOperation(fun, lhs, rhs)
 	}
+	if fun == operators.Subtract && isTimestampRelatedType(lhsType) && isTimestampRelatedType(rhsType) {
+		_, err := con.writeTimestampDiff(lhs, rhs)
+		return err
+	}
+	if isComparisonOperator(fun) && (con.isTimestampDiff(lhs) || con.isTimestampDiff(rhs)) {
+		return con.callDurationComparison(fun, lhs, rhs)
+	}
+	if isComparisonOperator(fun) && needsTemporalCoercion(lhsType, rhsType) {
+		return con.callTemporalComparison(expr, fun, lhs, rhs)
+	}
 	if !rhsParen && isLeftRecursive(fun) {
 		rhsParen = isSamePrecedence(fun, rhs)
 	}
@@ -295,10 +580,18 @@ func isDateTimeType(typ *exprpb.Type) bool {
 	return typ.GetAbstractType() != nil && typ.GetAbstractType().GetName() == "DATETIME"
 }
 
+func isDatePartType(typ *exprpb.Type) bool {
+	return typ.GetAbstractType() != nil && typ.GetAbstractType().GetName() == "date_part"
+}
+
 func isTimestampType(typ *exprpb.Type) bool {
 	return typ.GetWellKnown() == exprpb.Type_TIMESTAMP
 }
 
+func isDurationType(typ *exprpb.Type) bool {
+	return typ.GetWellKnown() == exprpb.Type_DURATION
+}
+
 func isDurationRelatedType(typ *exprpb.Type) bool {
 	abstractType := typ.GetAbstractType()
 	if abstractType != nil {
@@ -330,6 +623,14 @@ func (con *Converter) callTimestampOperation(fun string, lhs *exprpb.Expr, rhs *
 		panic("lhs or rhs must be timestamp related type")
 	}
 
+	return con.writeTimestampArithmetic(fun, timestampType, func() error {
+		return con.visitMaybeNested(timestamp, timestampParen)
+	}, duration, durationParen, nil)
+}
+
+// writeTimestampArithmetic adds duration to or subtracts it from the value written by writeTimestamp.
+// timeZone is only used when months or years are added to a TIMESTAMP, and may be nil.
+func (con *Converter) writeTimestampArithmetic(fun string, timestampType *exprpb.Type, writeTimestamp func() error, duration *exprpb.Expr, durationParen bool, timeZone *exprpb.Expr) error {
 	var sqlFun string
 	switch fun {
 	case operators.Add:
@@ -357,22 +658,418 @@ func (con *Converter) callTimestampOperation(fun string, lhs *exprpb.Expr, rhs *
 	default:
 		return fmt.Errorf("unsupported operation (%s)", fun)
 	}
+	d, known := durationUnits(duration)
+	if known && isDateType(timestampType) && d.clock != 0 {
+		return fmt.Errorf("cannot add hours, minutes or seconds to a DATE")
+	}
+	if known && d.isCalendar() {
+		return con.callCalendarOperation(fun, sqlFun, timestampType, writeTimestamp, duration, d, timeZone)
+	}
 	con.str.WriteString(sqlFun)
 	con.str.WriteString("(")
-	if err := con.visitMaybeNested(timestamp, timestampParen); err != nil {
+	if err := writeTimestamp(); err != nil {
 		return err
 	}
 	con.str.WriteString(", ")
-	if err := con.visitMaybeNested(duration, durationParen); err != nil {
+	if con.isTimestampDiff(duration) {
+		// the difference is an INT64, so it has to be wrapped back into an INTERVAL
+		diffArgs := duration.GetCallExpr().GetArgs()
+		con.str.WriteString("INTERVAL ")
+		unit, err := con.writeTimestampDiff(diffArgs[0], diffArgs[1])
+		if err != nil {
+			return err
+		}
+		con.str.WriteString(" ")
+		con.str.WriteString(unit)
+	} else if err := con.visitMaybeNested(duration, durationParen); err != nil {
+		return err
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+func calendarDurationLiteral(expr *exprpb.Expr) (calendarDuration, bool) {
+	c := expr.GetCallExpr()
+	if c == nil || c.GetFunction() != overloads.TypeConvertDuration || len(c.GetArgs()) != 1 || !isStringLiteral(c.GetArgs()[0]) {
+		return calendarDuration{}, false
+	}
+	d, err := parseDurationArgs(c.GetArgs())
+	return d, err == nil
+}
+
+// durationUnits returns a duration literal, or a duration of one unit for interval(n, date_part),
+// which tells the units of the duration if they are known at conversion time.
+func durationUnits(expr *exprpb.Expr) (calendarDuration, bool) {
+	if d, ok := calendarDurationLiteral(expr); ok {
+		return d, true
+	}
+	c := expr.GetCallExpr()
+	if c == nil || c.GetFunction() != "interval" || len(c.GetArgs()) != 2 {
+		return calendarDuration{}, false
+	}
+	switch c.GetArgs()[1].GetIdentExpr().GetName() {
+	case "YEAR", "ISOYEAR":
+		return calendarDuration{years: 1}, true
+	case "QUARTER", "MONTH":
+		return calendarDuration{months: 1}, true
+	case "WEEK", "ISOWEEK", "DAY":
+		return calendarDuration{days: 1}, true
+	case "HOUR", "MINUTE", "SECOND", "MILLISECOND", "MICROSECOND":
+		return calendarDuration{clock: time.Microsecond}, true
+	}
+	return calendarDuration{}, false
+}
+
+// callCalendarOperation adds or subtracts durations containing calendar units.
+// TIMESTAMP arithmetic rejects months and years because their length depends on the time zone,
+// so such timestamps are shifted as a DATETIME in timeZone, or UTC if it is nil.
+func (con *Converter) callCalendarOperation(fun string, sqlFun string, timestampType *exprpb.Type, writeTimestamp func() error, duration *exprpb.Expr, d calendarDuration, timeZone *exprpb.Expr) error {
+	date := isDateType(timestampType)
+	civil := isTimestampType(timestampType) && (d.years != 0 || d.months != 0)
+	if civil {
+		con.str.WriteString("TIMESTAMP(")
+		sqlFun = strings.Replace(sqlFun, "TIMESTAMP_", "DATETIME_", 1)
+		writeTimestamp = con.wrapTimeZoneCall("DATETIME", writeTimestamp, timeZone)
+	}
+	if d.isSingleUnit() {
+		con.str.WriteString(sqlFun)
+		con.str.WriteString("(")
+		if err := writeTimestamp(); err != nil {
+			return err
+		}
+		con.str.WriteString(", ")
+		if err := con.Visit(duration); err != nil {
+			return err
+		}
+		con.str.WriteString(")")
+	} else {
+		// MAKE_INTERVAL() can only be used with the arithmetic operators, which turn a DATE into a DATETIME
+		if date {
+			con.str.WriteString("DATE(")
+		}
+		if err := writeTimestamp(); err != nil {
+			return err
+		}
+		if fun == operators.Add {
+			con.str.WriteString(" + ")
+		} else {
+			con.str.WriteString(" - ")
+		}
+		if err := con.Visit(duration); err != nil {
+			return err
+		}
+		if date {
+			con.str.WriteString(")")
+		}
+	}
+	if civil {
+		if err := con.writeTimeZoneArg(timeZone); err != nil {
+			return err
+		}
+		con.str.WriteString(")")
+	}
+	return nil
+}
+
+// wrapTimeZoneCall returns a writer which wraps the output of write in a call of sqlFun with the time zone argument.
+func (con *Converter) wrapTimeZoneCall(sqlFun string, write func() error, timeZone *exprpb.Expr) func() error {
+	return func() error {
+		con.str.WriteString(sqlFun)
+		con.str.WriteString("(")
+		if err := write(); err != nil {
+			return err
+		}
+		if err := con.writeTimeZoneArg(timeZone); err != nil {
+			return err
+		}
+		con.str.WriteString(")")
+		return nil
+	}
+}
+
+// writeTimeZoneArg writes ", timeZone", falling back to the time zone given by WithTimeZone.
+// Nothing is written if neither of them is available.
+func (con *Converter) writeTimeZoneArg(timeZone *exprpb.Expr) error {
+	if !con.hasTimeZone(timeZone) {
+		return nil
+	}
+	con.str.WriteString(", ")
+	return con.writeTimeZone(timeZone)
+}
+
+func (con *Converter) hasTimeZone(timeZone *exprpb.Expr) bool {
+	return timeZone != nil || con.timeZone != ""
+}
+
+func (con *Converter) writeTimeZone(timeZone *exprpb.Expr) error {
+	if timeZone != nil {
+		return con.Visit(timeZone)
+	}
+	con.WriteValue(con.timeZone)
+	return nil
+}
+
+// isTimestampDiff reports whether expr subtracts two timestamp related values.
+// Such differences are lowered to an INT64 count of units instead of an INTERVAL.
+func (con *Converter) isTimestampDiff(expr *exprpb.Expr) bool {
+	c := expr.GetCallExpr()
+	if c == nil || c.GetFunction() != operators.Subtract || len(c.GetArgs()) != 2 {
+		return false
+	}
+	return isTimestampRelatedType(con.GetType(c.GetArgs()[0])) && isTimestampRelatedType(con.GetType(c.GetArgs()[1]))
+}
+
+// writeTimestampDiff writes the difference between lhs and rhs and returns the date part it is measured in.
+func (con *Converter) writeTimestampDiff(lhs *exprpb.Expr, rhs *exprpb.Expr) (string, error) {
+	var sqlFun, unit string
+	switch t := con.GetType(lhs); {
+	case isTimeType(t):
+		sqlFun, unit = "TIME_DIFF", "MICROSECOND"
+	case isDateType(t):
+		sqlFun, unit = "DATE_DIFF", "DAY"
+	case isDateTimeType(t):
+		sqlFun, unit = "DATETIME_DIFF", "MICROSECOND"
+	default:
+		sqlFun, unit = "TIMESTAMP_DIFF", "MICROSECOND"
+	}
+	con.str.WriteString(sqlFun)
+	con.str.WriteString("(")
+	if err := con.Visit(lhs); err != nil {
+		return "", err
+	}
+	con.str.WriteString(", ")
+	if err := con.Visit(rhs); err != nil {
+		return "", err
+	}
+	con.str.WriteString(", ")
+	con.str.WriteString(unit)
+	con.str.WriteString(")")
+	return unit, nil
+}
+
+// writeDurationMicros writes a duration as an INT64 number of microseconds.
+func (con *Converter) writeDurationMicros(expr *exprpb.Expr) error {
+	if con.isTimestampDiff(expr) {
+		args := expr.GetCallExpr().GetArgs()
+		unit, err := con.writeTimestampDiff(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		if unit == "DAY" {
+			con.str.WriteString(" * ")
+			con.str.WriteString(strconv.FormatInt(int64(24*time.Hour/time.Microsecond), 10))
+		}
+		return nil
+	}
+	if d, ok := calendarDurationLiteral(expr); ok {
+		if d.years != 0 || d.months != 0 {
+			return fmt.Errorf("durations in years or months have no fixed length")
+		}
+		micros := (time.Duration(d.days)*24*time.Hour + d.clock).Microseconds()
+		con.str.WriteString(strconv.FormatInt(micros, 10))
+		return nil
+	}
+	if isDurationRelatedType(con.GetType(expr)) {
+		// an INTERVAL is measured by adding it to the epoch, which fails in BigQuery if it contains months or years
+		con.str.WriteString(`UNIX_MICROS(TIMESTAMP "1970-01-01 00:00:00+00:00" + `)
+		if err := con.visitMaybeNested(expr, isComplexOperatorWithRespectTo(operators.Add, expr)); err != nil {
+			return err
+		}
+		con.str.WriteString(")")
+		return nil
+	}
+	return fmt.Errorf("unsupported duration operand: %v", expr)
+}
+
+func isComparisonOperator(fun string) bool {
+	switch fun {
+	case operators.Equals,
+		operators.NotEquals,
+		operators.Less,
+		operators.LessEquals,
+		operators.Greater,
+		operators.GreaterEquals:
+		return true
+	}
+	return false
+}
+
+func (con *Converter) callDurationComparison(fun string, lhs *exprpb.Expr, rhs *exprpb.Expr) error {
+	if err := con.writeDurationMicros(lhs); err != nil {
+		return err
+	}
+	con.writeComparisonOperator(fun)
+	return con.writeDurationMicros(rhs)
+}
+
+func (con *Converter) writeComparisonOperator(fun string) {
+	operator, found := standardSQLBinaryOperators[fun]
+	if !found {
+		operator, _ = operators.FindReverseBinaryOperator(fun)
+	}
+	con.str.WriteString(" ")
+	con.str.WriteString(operator)
+	con.str.WriteString(" ")
+}
+
+// temporalPrecision orders the temporal types which can be coerced into each other.
+// It returns -1 for other types.
+func temporalPrecision(typ *exprpb.Type) int {
+	switch {
+	case isDateType(typ):
+		return 0
+	case isDateTimeType(typ):
+		return 1
+	case isTimestampType(typ):
+		return 2
+	}
+	return -1
+}
+
+// unwrapDyn returns the argument of dyn(), which only affects type checking.
+func unwrapDyn(expr *exprpb.Expr) *exprpb.Expr {
+	for {
+		c := expr.GetCallExpr()
+		if c.GetFunction() != overloads.TypeConvertDyn || c.GetTarget() != nil || len(c.GetArgs()) != 1 {
+			return expr
+		}
+		expr = c.GetArgs()[0]
+	}
+}
+
+func temporalTypeName(typ *exprpb.Type) string {
+	if isTimestampType(typ) {
+		return "TIMESTAMP"
+	}
+	return typ.GetAbstractType().GetName()
+}
+
+func needsTemporalCoercion(lhsType *exprpb.Type, rhsType *exprpb.Type) bool {
+	if IsStringType(lhsType) {
+		return isTimestampRelatedType(rhsType)
+	}
+	if IsStringType(rhsType) {
+		return isTimestampRelatedType(lhsType)
+	}
+	lhsPrecision, rhsPrecision := temporalPrecision(lhsType), temporalPrecision(rhsType)
+	return lhsPrecision >= 0 && rhsPrecision >= 0 && lhsPrecision != rhsPrecision
+}
+
+// callTemporalComparison compares values of different temporal types, or a temporal value with a string.
+// Strings are parsed as the other operand. Otherwise the less precise operand is cast to the more precise type,
+// unless only the more precise operand is constant; then it is cast instead, which keeps columns
+// like partitioning dates bare.
+func (con *Converter) callTemporalComparison(expr *exprpb.Expr, fun string, lhs *exprpb.Expr, rhs *exprpb.Expr) error {
+	lhsType := con.GetType(lhs)
+	rhsType := con.GetType(rhs)
+	var target *exprpb.Type
+	switch {
+	case IsStringType(lhsType):
+		target = rhsType
+	case IsStringType(rhsType):
+		target = lhsType
+	default:
+		wide, narrow := lhs, rhs
+		target = rhsType
+		if temporalPrecision(lhsType) < temporalPrecision(rhsType) {
+			wide, narrow = rhs, lhs
+			target = lhsType
+		}
+		if !isConstantExpr(wide) || isConstantExpr(narrow) {
+			target = con.GetType(wide)
+		}
+	}
+	if err := con.writeCoerced(expr, lhs, target, isComplexOperatorWithRespectTo(fun, lhs)); err != nil {
+		return err
+	}
+	con.writeComparisonOperator(fun)
+	return con.writeCoerced(expr, rhs, target, isComplexOperatorWithRespectTo(fun, rhs) || isSamePrecedence(fun, rhs))
+}
+
+// writeCoerced writes operand as the target temporal type.
+func (con *Converter) writeCoerced(expr *exprpb.Expr, operand *exprpb.Expr, target *exprpb.Type, paren bool) error {
+	typ := con.GetType(operand)
+	targetName := temporalTypeName(target)
+	switch {
+	case IsStringType(typ):
+		if isStringLiteral(operand) {
+			val, err := parseTemporalLiteral(temporalConstructors[targetName], operand.GetConstExpr().GetStringValue())
+			if err != nil {
+				return err
+			}
+			con.WriteValue(val)
+			return nil
+		}
+		con.str.WriteString("CAST(")
+		if err := con.Visit(operand); err != nil {
+			return err
+		}
+		con.str.WriteString(" AS ")
+		con.str.WriteString(targetName)
+		con.str.WriteString(")")
+		return nil
+	case temporalPrecision(typ) == temporalPrecision(target):
+		return con.visitMaybeNested(operand, paren)
+	}
+	typeName := temporalTypeName(typ)
+	timeZone := con.timeZone
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+	switch {
+	case isTimestampType(typ):
+		con.addWarning(expr, "comparing %s with TIMESTAMP converts the TIMESTAMP to %s in %s", targetName, targetName, timeZone)
+	case isTimestampType(target):
+		con.addWarning(expr, "comparing %s with TIMESTAMP interprets the %s in %s", typeName, typeName, timeZone)
+	case temporalPrecision(typ) > temporalPrecision(target):
+		con.addWarning(expr, "comparing %s with %s truncates the %s", targetName, typeName, typeName)
+	}
+	con.str.WriteString(targetName)
+	con.str.WriteString("(")
+	if err := con.Visit(operand); err != nil {
 		return err
 	}
+	if isTimestampType(typ) || isTimestampType(target) {
+		if err := con.writeTimeZoneArg(nil); err != nil {
+			return err
+		}
+	}
 	con.str.WriteString(")")
 	return nil
 }
 
+var temporalConstructors = map[string]string{
+	"DATE":      "date",
+	"DATETIME":  "datetime",
+	"TIME":      "time",
+	"TIMESTAMP": overloads.TypeConvertTimestamp,
+}
+
+// isConstantExpr reports whether expr does not refer to any identifiers.
+func isConstantExpr(expr *exprpb.Expr) bool {
+	switch e := expr.GetExprKind().(type) {
+	case *exprpb.Expr_ConstExpr:
+		return true
+	case *exprpb.Expr_CallExpr:
+		if e.CallExpr.GetTarget() != nil && !isConstantExpr(e.CallExpr.GetTarget()) {
+			return false
+		}
+		for _, arg := range e.CallExpr.GetArgs() {
+			if !isConstantExpr(arg) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 func (con *Converter) visitCallConditional(expr *exprpb.Expr) error {
 	c := expr.GetCallExpr()
 	args := c.GetArgs()
+	if isConditional(args[2]) {
+		return con.callCase(expr)
+	}
 	con.str.WriteString("IF(")
 	if err := con.Visit(args[0]); err != nil {
 		return err
@@ -383,18 +1080,61 @@ func (con *Converter) visitCallConditional(expr *exprpb.Expr) error {
 	}
 	con.str.WriteString(", ")
 	if err := con.Visit(args[2]); err != nil {
-		return nil
+		return err
 	}
 	con.str.WriteString(")")
 	return nil
 }
 
+func isConditional(expr *exprpb.Expr) bool {
+	return expr.GetCallExpr().GetFunction() == operators.Conditional
+}
+
+// callCase flattens chained conditional operators like a ? x : b ? y : z into a single CASE expression.
+func (con *Converter) callCase(expr *exprpb.Expr) error {
+	con.str.WriteString("CASE")
+	for isConditional(expr) {
+		args := expr.GetCallExpr().GetArgs()
+		con.str.WriteString(" WHEN ")
+		if err := con.Visit(args[0]); err != nil {
+			return err
+		}
+		con.str.WriteString(" THEN ")
+		if err := con.Visit(args[1]); err != nil {
+			return err
+		}
+		expr = args[2]
+	}
+	con.str.WriteString(" ELSE ")
+	if err := con.Visit(expr); err != nil {
+		return err
+	}
+	con.str.WriteString(" END")
+	return nil
+}
+
 var standardSQLFunctions = map[string]string{
 	operators.Modulo:     "MOD",
 	overloads.StartsWith: "STARTS_WITH",
 	overloads.EndsWith:   "ENDS_WITH",
 	overloads.Matches:    "REGEXP_CONTAINS",
 	"lowerAscii":         "LOWER",
+	"upperAscii":         "UPPER",
+}
+
+// standardSQLNamespaces maps the namespaces of CEL functions like net.host() to SQL function namespaces.
+var standardSQLNamespaces = map[string]string{
+	"net": "NET",
+}
+
+// sqlFunctionName returns the SQL function name of a global CEL function, e.g. NET.HOST for net.host.
+func sqlFunctionName(fun string) string {
+	if i := strings.LastIndex(fun, "."); i >= 0 {
+		if namespace, ok := standardSQLNamespaces[fun[:i]]; ok {
+			return namespace + "." + strings.ToUpper(fun[i+1:])
+		}
+	}
+	return strings.ToUpper(fun)
 }
 
 func (con *Converter) callContains(target *exprpb.Expr, args []*exprpb.Expr) error {
@@ -429,13 +1169,10 @@ func (con *Converter) callReplace(target *exprpb.Expr, args []*exprpb.Expr) erro
 			return err
 		}
 	}
-
-	if len(args) != 2 {
-		return fmt.Errorf("string_replace_string_string_int variant of string.replace() is not supported")
-	}
-
-	for _, arg := range args {
-		con.str.WriteString(", ")
+	for i, arg := range args {
+		if i > 0 || target != nil {
+			con.str.WriteString(", ")
+		}
 		err := con.Visit(arg)
 		if err != nil {
 			return err
@@ -445,9 +1182,9 @@ func (con *Converter) callReplace(target *exprpb.Expr, args []*exprpb.Expr) erro
 	return nil
 }
 
-func (con *Converter) callDuration(target *exprpb.Expr, args []*exprpb.Expr) error {
+func parseDurationArgs(args []*exprpb.Expr) (calendarDuration, error) {
 	if len(args) != 1 {
-		return fmt.Errorf("arguments must be single")
+		return calendarDuration{}, fmt.Errorf("arguments must be single")
 	}
 	arg := args[0]
 	var durationString string
@@ -457,15 +1194,65 @@ func (con *Converter) callDuration(target *exprpb.Expr, args []*exprpb.Expr) err
 		case *exprpb.Constant_StringValue:
 			durationString = arg.GetConstExpr().GetStringValue()
 		default:
-			return fmt.Errorf("unsupported constant kind %t", arg.GetConstExpr().ConstantKind)
+			return calendarDuration{}, fmt.Errorf("unsupported constant kind %t", arg.GetConstExpr().ConstantKind)
 		}
 	default:
-		return fmt.Errorf("unsupported kind %t", arg.ExprKind)
+		return calendarDuration{}, fmt.Errorf("unsupported kind %t", arg.ExprKind)
+	}
+	return parseCalendarDuration(durationString)
+}
+
+func (con *Converter) callDuration(target *exprpb.Expr, args []*exprpb.Expr) error {
+	if len(args) != 1 {
+		return fmt.Errorf("arguments must be single")
+	}
+	if !isStringLiteral(args[0]) {
+		return con.callDurationCast(args[0])
 	}
-	d, err := time.ParseDuration(durationString)
+	d, err := parseDurationArgs(args)
 	if err != nil {
 		return err
 	}
+	if !d.isCalendar() {
+		con.writeClockInterval(d.clock)
+		return nil
+	}
+	switch {
+	case d.clock == 0 && d.months == 0 && d.days == 0:
+		con.str.WriteString("INTERVAL ")
+		con.str.WriteString(strconv.FormatInt(d.years, 10))
+		con.str.WriteString(" YEAR")
+		return nil
+	case d.clock == 0 && d.years == 0 && d.days == 0:
+		con.str.WriteString("INTERVAL ")
+		con.str.WriteString(strconv.FormatInt(d.months, 10))
+		con.str.WriteString(" MONTH")
+		return nil
+	case d.clock == 0 && d.years == 0 && d.months == 0:
+		con.str.WriteString("INTERVAL ")
+		con.str.WriteString(strconv.FormatInt(d.days, 10))
+		con.str.WriteString(" DAY")
+		return nil
+	}
+	if d.clock != d.clock.Truncate(time.Second) {
+		return fmt.Errorf("sub-second durations cannot be combined with calendar units")
+	}
+	hours := d.clock / time.Hour
+	minutes := (d.clock % time.Hour) / time.Minute
+	seconds := (d.clock % time.Minute) / time.Second
+	con.str.WriteString("MAKE_INTERVAL(")
+	for i, v := range []int64{d.years, d.months, d.days, int64(hours), int64(minutes), int64(seconds)} {
+		if i != 0 {
+			con.str.WriteString(", ")
+		}
+		con.str.WriteString(strconv.FormatInt(v, 10))
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+// writeClockInterval writes d as an INTERVAL of the largest unit which represents it exactly.
+func (con *Converter) writeClockInterval(d time.Duration) {
 	con.str.WriteString("INTERVAL ")
 	switch d {
 	case d.Round(time.Hour):
@@ -484,87 +1271,413 @@ func (con *Converter) callDuration(target *exprpb.Expr, args []*exprpb.Expr) err
 		con.str.WriteString(strconv.FormatInt(d.Truncate(time.Microsecond).Microseconds(), 10))
 		con.str.WriteString(" MICROSECOND")
 	}
+}
+
+// callDurationCast converts durations which are not known at conversion time.
+// Strings are cast to INTERVAL, so they must use one of the BigQuery interval formats.
+func (con *Converter) callDurationCast(arg *exprpb.Expr) error {
+	switch argType := con.GetType(arg); {
+	case isDurationType(argType):
+		return con.Visit(arg)
+	case IsStringType(argType):
+		con.str.WriteString("CAST(")
+		if err := con.Visit(arg); err != nil {
+			return err
+		}
+		con.str.WriteString(" AS INTERVAL)")
+		return nil
+	default:
+		return fmt.Errorf("unsupported duration argument type: %v", argType)
+	}
+}
+
+func (con *Converter) callInterval(target *exprpb.Expr, args []*exprpb.Expr) error {
+	con.str.WriteString("INTERVAL ")
+	if err := con.Visit(args[0]); err != nil {
+		return err
+	}
+	con.str.WriteString(" ")
+	datePart := args[1]
+	con.str.WriteString(datePart.GetIdentExpr().GetName())
+	return nil
+}
+
+func (con *Converter) callExtractFromTimestamp(function string, target *exprpb.Expr, args []*exprpb.Expr) error {
+	con.str.WriteString("EXTRACT(")
+	switch function {
+	case overloads.TimeGetFullYear:
+		con.str.WriteString("YEAR")
+	case overloads.TimeGetMonth:
+		con.str.WriteString("MONTH")
+	case overloads.TimeGetDate:
+		con.str.WriteString("DAY")
+	case overloads.TimeGetHours:
+		con.str.WriteString("HOUR")
+	case overloads.TimeGetMinutes:
+		con.str.WriteString("MINUTE")
+	case overloads.TimeGetSeconds:
+		con.str.WriteString("SECOND")
+	case overloads.TimeGetMilliseconds:
+		con.str.WriteString("MILLISECOND")
+	case overloads.TimeGetDayOfYear:
+		con.str.WriteString("DAYOFYEAR")
+	case overloads.TimeGetDayOfMonth:
+		con.str.WriteString("DAY")
+	case overloads.TimeGetDayOfWeek:
+		con.str.WriteString("DAYOFWEEK")
+	}
+	con.str.WriteString(" FROM ")
+	if err := con.Visit(target); err != nil {
+		return err
+	}
+	var timeZone *exprpb.Expr
+	if len(args) == 1 {
+		timeZone = args[0]
+	}
+	if isTimestampType(con.GetType(target)) && con.hasTimeZone(timeZone) {
+		con.str.WriteString(" AT TIME ZONE ")
+		if err := con.writeTimeZone(timeZone); err != nil {
+			return err
+		}
+	}
+	con.str.WriteString(")")
+	if function == overloads.TimeGetMonth || function == overloads.TimeGetDayOfYear || function == overloads.TimeGetDayOfMonth || function == overloads.TimeGetDayOfWeek {
+		con.str.WriteString(" - 1")
+	}
+	return nil
+}
+
+func (con *Converter) callExtractFromDuration(function string, target *exprpb.Expr) error {
+	var unit time.Duration
+	switch function {
+	case overloads.TimeGetHours:
+		unit = time.Hour
+	case overloads.TimeGetMinutes:
+		unit = time.Minute
+	case overloads.TimeGetSeconds:
+		unit = time.Second
+	case overloads.TimeGetMilliseconds:
+		unit = time.Millisecond
+	default:
+		return fmt.Errorf("unsupported duration function: %s", function)
+	}
+	con.str.WriteString("DIV(")
+	if err := con.writeDurationMicros(target); err != nil {
+		return err
+	}
+	con.str.WriteString(", ")
+	con.str.WriteString(strconv.FormatInt(int64(unit/time.Microsecond), 10))
+	con.str.WriteString(")")
+	return nil
+}
+
+func (con *Converter) callTimestampTrunc(target *exprpb.Expr, args []*exprpb.Expr) error {
+	c := args[0].GetIdentExpr()
+	if c == nil {
+		return fmt.Errorf("trunc() argument must be constant")
+	}
+	str := c.GetName()
+	if strings.IndexFunc(str, func(r rune) bool { return r < 'A' || r > 'Z' }) != -1 {
+		return fmt.Errorf("trunc() argument must be an upper case word")
+	}
+	var timeZone *exprpb.Expr
+	if len(args) > 1 {
+		timeZone = args[1]
+	}
+	return con.writeTrunc(con.GetType(target), func() error {
+		return con.Visit(target)
+	}, str, timeZone)
+}
+
+func (con *Converter) writeTrunc(t *exprpb.Type, writeTarget func() error, datePart string, timeZone *exprpb.Expr) error {
+	if isTimestampType(t) {
+		con.str.WriteString("TIMESTAMP_TRUNC(")
+	} else if isDateTimeType(t) {
+		con.str.WriteString("DATETIME_TRUNC(")
+	} else if isDateType(t) {
+		con.str.WriteString("DATE_TRUNC(")
+	} else if isTimeType(t) {
+		con.str.WriteString("TIME_TRUNC(")
+	} else {
+		panic("unexpected trunc() target type")
+	}
+	if err := writeTarget(); err != nil {
+		return err
+	}
+	con.str.WriteString(", ")
+	con.str.WriteString(datePart)
+	if isTimestampType(t) {
+		if err := con.writeTimeZoneArg(timeZone); err != nil {
+			return err
+		}
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+// currentTimeWriter returns a writer of the current time of the given type.
+// timeZone is ignored for TIMESTAMP, which is an absolute point in time.
+func (con *Converter) currentTimeWriter(t *exprpb.Type, timeZone *exprpb.Expr) func() error {
+	return func() error {
+		switch {
+		case isDateType(t):
+			return con.writeCurrentTime("DATE", timeZone)
+		case isDateTimeType(t):
+			return con.writeCurrentTime("DATETIME", timeZone)
+		case isTimeType(t):
+			return con.writeCurrentTime("TIME", timeZone)
+		default:
+			return con.writeCurrentTime("TIMESTAMP", nil)
+		}
+	}
+}
+
+// writeCurrentTime writes the current time as sqlType, e.g. CURRENT_DATE(time_zone).
+// With WithNow, the fixed time is written instead and converted to sqlType.
+func (con *Converter) writeCurrentTime(sqlType string, timeZone *exprpb.Expr) error {
+	if con.now == nil {
+		con.str.WriteString("CURRENT_")
+		con.str.WriteString(sqlType)
+		con.str.WriteString("(")
+		// CURRENT_TIMESTAMP() is independent of time zones
+		if sqlType != "TIMESTAMP" && con.hasTimeZone(timeZone) {
+			if err := con.writeTimeZone(timeZone); err != nil {
+				return err
+			}
+		}
+		con.str.WriteString(")")
+		return nil
+	}
+	if sqlType == "TIMESTAMP" {
+		con.WriteValue(*con.now)
+		return nil
+	}
+	con.str.WriteString(sqlType)
+	con.str.WriteString("(")
+	con.WriteValue(*con.now)
+	if err := con.writeTimeZoneArg(timeZone); err != nil {
+		return err
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+// callGreatestLeast converts greatest() and least(), as well as math.greatest() and math.least() of ext.Math.
+// Their macros pass either a single value, two values or a list.
+func (con *Converter) callGreatestLeast(fun string, args []*exprpb.Expr) error {
+	sqlFun, aggregate := "GREATEST", "MAX"
+	if fun == "math.@min" || fun == "least" {
+		sqlFun, aggregate = "LEAST", "MIN"
+	}
+	if len(args) == 1 && IsListType(con.GetType(args[0])) {
+		if list := args[0].GetListExpr(); list != nil {
+			args = list.GetElements()
+		} else {
+			con.str.WriteString("(SELECT ")
+			con.str.WriteString(aggregate)
+			con.str.WriteString("(v) FROM UNNEST(")
+			if err := con.Visit(args[0]); err != nil {
+				return err
+			}
+			con.str.WriteString(") AS v)")
+			return nil
+		}
+	}
+	if len(args) == 1 {
+		return con.Visit(args[0])
+	}
+	con.str.WriteString(sqlFun)
+	con.str.WriteString("(")
+	for i, arg := range args {
+		if i > 0 {
+			con.str.WriteString(", ")
+		}
+		if err := con.Visit(arg); err != nil {
+			return err
+		}
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+// callCoalesce converts coalesce(), whose macro passes the arguments as a list literal.
+func (con *Converter) callCoalesce(list *exprpb.Expr) error {
+	if list.GetListExpr() == nil {
+		return fmt.Errorf("coalesce() requires the macro in sqltypes.AdditionalMacros")
+	}
+	con.str.WriteString("COALESCE(")
+	for i, elem := range list.GetListExpr().GetElements() {
+		if i > 0 {
+			con.str.WriteString(", ")
+		}
+		if err := con.Visit(elem); err != nil {
+			return err
+		}
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+// callWithDefaultTimeZone writes a function call with the time zone given by WithTimeZone as the last argument.
+func (con *Converter) callWithDefaultTimeZone(fun string, args []*exprpb.Expr) error {
+	con.str.WriteString(strings.ToUpper(fun))
+	con.str.WriteString("(")
+	for i, arg := range args {
+		if i > 0 {
+			con.str.WriteString(", ")
+		}
+		if err := con.Visit(arg); err != nil {
+			return err
+		}
+	}
+	if err := con.writeTimeZoneArg(nil); err != nil {
+		return err
+	}
+	con.str.WriteString(")")
 	return nil
 }
 
-func (con *Converter) callInterval(target *exprpb.Expr, args []*exprpb.Expr) error {
-	con.str.WriteString("INTERVAL ")
-	if err := con.Visit(args[0]); err != nil {
+// callTemporalLiteral validates constant temporal constructors like date("2023-01-01"),
+// and writes them as typed values so malformed literals are reported at conversion time.
+func (con *Converter) callTemporalLiteral(fun string, str string) error {
+	val, err := parseTemporalLiteral(fun, str)
+	if err != nil {
 		return err
 	}
-	con.str.WriteString(" ")
-	datePart := args[1]
-	con.str.WriteString(datePart.GetIdentExpr().GetName())
+	con.WriteValue(val)
 	return nil
 }
 
-func (con *Converter) callExtractFromTimestamp(function string, target *exprpb.Expr, args []*exprpb.Expr) error {
-	con.str.WriteString("EXTRACT(")
-	switch function {
-	case overloads.TimeGetFullYear:
-		con.str.WriteString("YEAR")
-	case overloads.TimeGetMonth:
-		con.str.WriteString("MONTH")
-	case overloads.TimeGetDate:
-		con.str.WriteString("DAY")
-	case overloads.TimeGetHours:
-		con.str.WriteString("HOUR")
-	case overloads.TimeGetMinutes:
-		con.str.WriteString("MINUTE")
-	case overloads.TimeGetSeconds:
-		con.str.WriteString("SECOND")
-	case overloads.TimeGetMilliseconds:
-		con.str.WriteString("MILLISECOND")
-	case overloads.TimeGetDayOfYear:
-		con.str.WriteString("DAYOFYEAR")
-	case overloads.TimeGetDayOfMonth:
-		con.str.WriteString("DAY")
-	case overloads.TimeGetDayOfWeek:
-		con.str.WriteString("DAYOFWEEK")
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02T15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// parseTemporalLiteral parses str as the type constructed by fun.
+// Timestamps without an offset are in UTC, as in BigQuery.
+func parseTemporalLiteral(fun string, str string) (interface{}, error) {
+	switch fun {
+	case "date":
+		d, err := civil.ParseDate(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date literal %q: %w", str, err)
+		}
+		return d, nil
+	case "datetime":
+		dt, err := civil.ParseDateTime(strings.Replace(str, " ", "T", 1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid datetime literal %q: %w", str, err)
+		}
+		return dt, nil
+	case "time":
+		t, err := civil.ParseTime(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time literal %q: %w", str, err)
+		}
+		return t, nil
+	case overloads.TypeConvertTimestamp:
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, str); err == nil {
+				return t.UTC(), nil
+			}
+		}
+		return nil, fmt.Errorf("invalid timestamp literal %q", str)
+	default:
+		return nil, fmt.Errorf("unsupported temporal type: %s", fun)
 	}
-	con.str.WriteString(" FROM ")
-	if err := con.Visit(target); err != nil {
+}
+
+// callTimestampConversion converts a TIMESTAMP to a civil time type in the default time zone.
+func (con *Converter) callTimestampConversion(fun string, timestamp *exprpb.Expr) error {
+	con.str.WriteString(strings.ToUpper(fun))
+	con.str.WriteString("(")
+	if err := con.Visit(timestamp); err != nil {
 		return err
 	}
-	if isTimestampType(con.GetType(target)) && len(args) == 1 {
-		con.str.WriteString(" AT ")
-		if err := con.Visit(args[0]); err != nil {
-			return err
-		}
+	if err := con.writeTimeZoneArg(nil); err != nil {
+		return err
 	}
 	con.str.WriteString(")")
-	if function == overloads.TimeGetMonth || function == overloads.TimeGetDayOfYear || function == overloads.TimeGetDayOfMonth || function == overloads.TimeGetDayOfWeek {
-		con.str.WriteString(" - 1")
-	}
 	return nil
 }
 
-func (con *Converter) callTimestampTrunc(target *exprpb.Expr, args []*exprpb.Expr) error {
-	t := con.GetType(target)
-	if isTimestampType(t) {
-		con.str.WriteString("TIMESTAMP_TRUNC(")
-	} else if isDateTimeType(t) {
-		con.str.WriteString("DATETIME_TRUNC(")
-	} else if isDateType(t) {
-		con.str.WriteString("DATE_TRUNC(")
-	} else if isTimeType(t) {
-		con.str.WriteString("TIME_TRUNC(")
-	} else {
-		panic("unexpected trunc() target type")
+// callAgo converts ago(duration[, time_zone]) into the timestamp the duration before now.
+func (con *Converter) callAgo(args []*exprpb.Expr) error {
+	var timeZone *exprpb.Expr
+	if len(args) > 1 {
+		timeZone = args[1]
 	}
-	if err := con.Visit(target); err != nil {
+	timestampType := decls.Timestamp
+	if err := checkTimestampTimeZone(timestampType, args[0], timeZone); err != nil {
 		return err
 	}
-	c := args[0].GetIdentExpr()
-	if c == nil {
-		return fmt.Errorf("trunc() argument must be constant")
+	return con.writeTimestampArithmetic(operators.Subtract, timestampType, con.currentTimeWriter(timestampType, timeZone), args[0], false, timeZone)
+}
+
+// checkTimestampTimeZone rejects the time zone of ago() or within_last() on a TIMESTAMP unless the duration has
+// years or months, since only their lengths depend on the time zone.
+func checkTimestampTimeZone(timestampType *exprpb.Type, duration *exprpb.Expr, timeZone *exprpb.Expr) error {
+	if timeZone == nil || !isTimestampType(timestampType) {
+		return nil
 	}
-	str := c.GetName()
-	if strings.IndexFunc(str, func(r rune) bool { return r < 'A' || r > 'Z' }) != -1 {
-		return fmt.Errorf("trunc() argument must be an upper case word")
+	if d, known := durationUnits(duration); known && (d.years != 0 || d.months != 0) {
+		return nil
+	}
+	return fmt.Errorf("the time zone of a TIMESTAMP only applies to durations of years or months")
+}
+
+// callWithinLast converts within_last(timestamp, duration[, time_zone]) into timestamp >= ago(duration).
+func (con *Converter) callWithinLast(args []*exprpb.Expr) error {
+	var timeZone *exprpb.Expr
+	if len(args) > 2 {
+		timeZone = args[2]
+	}
+	timestamp := args[0]
+	if err := checkTimestampTimeZone(con.GetType(timestamp), args[1], timeZone); err != nil {
+		return err
+	}
+	// comparisons are not associative in BigQuery, so the comparison is parenthesized like a function call
+	con.str.WriteString("(")
+	if err := con.visitMaybeNested(timestamp, isBinaryOrTernaryOperator(timestamp)); err != nil {
+		return err
+	}
+	con.str.WriteString(" >= ")
+	timestampType := con.GetType(timestamp)
+	if err := con.writeTimestampArithmetic(operators.Subtract, timestampType, con.currentTimeWriter(timestampType, timeZone), args[1], false, timeZone); err != nil {
+		return err
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+// callToday converts today([time_zone]) into the start of the current day.
+func (con *Converter) callToday(args []*exprpb.Expr) error {
+	var timeZone *exprpb.Expr
+	if len(args) > 0 {
+		timeZone = args[0]
+	}
+	timestampType := decls.Timestamp
+	return con.writeTrunc(timestampType, con.currentTimeWriter(timestampType, nil), "DAY", timeZone)
+}
+
+func (con *Converter) callBetween(args []*exprpb.Expr) error {
+	con.str.WriteString("(")
+	for i, arg := range args {
+		switch i {
+		case 1:
+			con.str.WriteString(" BETWEEN ")
+		case 2:
+			con.str.WriteString(" AND ")
+		}
+		if err := con.visitMaybeNested(arg, isBinaryOrTernaryOperator(arg)); err != nil {
+			return err
+		}
 	}
-	con.str.WriteString(", ")
-	con.str.WriteString(str)
 	con.str.WriteString(")")
 	return nil
 }
@@ -608,18 +1721,113 @@ func (con *Converter) visitCallFunc(expr *exprpb.Expr) error {
 	target := c.GetTarget()
 	args := c.GetArgs()
 	switch fun {
+	case overloads.TypeConvertDyn:
+		return con.visitMaybeNested(args[0], isBinaryOrTernaryOperator(args[0]))
 	case "get":
 		return con.visitCallListGet(target, args)
 	case overloads.Contains:
 		return con.callContains(target, args)
 	case "replace":
+		if len(args) == 3 && target != nil {
+			return con.callReplaceLimit(target, args)
+		}
 		return con.callReplace(target, args)
+	case "charAt":
+		return con.callCharAt(target, args)
+	case "indexOf":
+		return con.callIndexOf(target, args)
+	case "lastIndexOf":
+		return con.callLastIndexOf(target, args)
+	case "substring":
+		return con.callSubstring(target, args)
+	case "split":
+		if len(args) == 2 && target != nil {
+			return con.callSplitLimit(target, args)
+		}
+	case "join":
+		return con.callJoin(target, args)
+	case "format":
+		return con.callFormat(target, args)
+	case "strings.quote":
+		return con.callQuote(args)
 	case overloads.TypeConvertDuration:
 		return con.callDuration(target, args)
 	case "interval":
 		return con.callInterval(target, args)
 	case "trunc":
-		return con.callTimestampTrunc(target, args)
+		if target != nil {
+			return con.callTimestampTrunc(target, args)
+		}
+	case "optional.of":
+		return con.Visit(args[0])
+	case "optional.ofNonZeroValue":
+		return con.callOptionalOfNonZeroValue(args[0])
+	case "optional.none":
+		con.WriteTypedValue(nil, unwrapOptionalType(con.GetType(expr)))
+		return nil
+	case "value":
+		if target != nil && isOptionalType(con.GetType(target)) {
+			return con.Visit(target)
+		}
+	case "hasValue":
+		if target != nil && isOptionalType(con.GetType(target)) {
+			if err := con.visitMaybeNested(target, isBinaryOrTernaryOperator(target)); err != nil {
+				return err
+			}
+			con.str.WriteString(" IS NOT NULL")
+			return nil
+		}
+	case "or", "orValue":
+		if target != nil && isOptionalType(con.GetType(target)) {
+			return con.callOptionalOr(fun, target, args)
+		}
+	case "math.@max", "math.@min", "greatest", "least":
+		return con.callGreatestLeast(fun, args)
+	case "coalesce":
+		return con.callCoalesce(args[0])
+	case "distinct":
+		return con.callListDistinct(target)
+	case "flatten":
+		return con.callListFlatten(target)
+	case "slice":
+		return con.callListSlice(target, args)
+	case "lists.range":
+		return con.callListsRange(args[0])
+	case "start_of", "date_trunc", "datetime_trunc", "time_trunc", "timestamp_trunc":
+		return con.callTimestampTrunc(args[0], args[1:])
+	case "date_add", "datetime_add", "time_add", "timestamp_add":
+		return con.writeTimestampArithmetic(operators.Add, con.GetType(args[0]), func() error {
+			return con.Visit(args[0])
+		}, args[1], false, nil)
+	case "date_sub", "datetime_sub", "time_sub", "timestamp_sub":
+		return con.writeTimestampArithmetic(operators.Subtract, con.GetType(args[0]), func() error {
+			return con.Visit(args[0])
+		}, args[1], false, nil)
+	case "format_timestamp", "parse_timestamp":
+		if len(args) == 2 && con.hasTimeZone(nil) {
+			return con.callWithDefaultTimeZone(fun, args)
+		}
+	case "ago":
+		return con.callAgo(args)
+	case "within_last":
+		return con.callWithinLast(args)
+	case "today":
+		return con.callToday(args)
+	case "between":
+		return con.callBetween(args)
+	case "date", "datetime", "time", overloads.TypeConvertTimestamp:
+		if len(args) == 1 && isStringLiteral(args[0]) {
+			return con.callTemporalLiteral(fun, args[0].GetConstExpr().GetStringValue())
+		}
+		if fun != overloads.TypeConvertTimestamp && len(args) == 1 && isTimestampType(con.GetType(args[0])) && con.hasTimeZone(nil) {
+			return con.callTimestampConversion(fun, args[0])
+		}
+	case "current_timestamp", "current_date", "current_datetime", "current_time":
+		var timeZone *exprpb.Expr
+		if len(args) > 0 {
+			timeZone = args[0]
+		}
+		return con.writeCurrentTime(strings.ToUpper(strings.TrimPrefix(fun, "current_")), timeZone)
 	case overloads.TimeGetFullYear,
 		overloads.TimeGetMonth,
 		overloads.TimeGetDate,
@@ -630,6 +1838,9 @@ func (con *Converter) visitCallFunc(expr *exprpb.Expr) error {
 		overloads.TimeGetDayOfYear,
 		overloads.TimeGetDayOfMonth,
 		overloads.TimeGetDayOfWeek:
+		if isDurationType(con.GetType(target)) {
+			return con.callExtractFromDuration(fun, target)
+		}
 		return con.callExtractFromTimestamp(fun, target, args)
 	case overloads.TypeConvertBool,
 		overloads.TypeConvertBytes,
@@ -654,7 +1865,11 @@ func (con *Converter) visitCallFunc(expr *exprpb.Expr) error {
 	sqlFun, ok := standardSQLFunctions[fun]
 	if !ok {
 		if fun == overloads.Size {
-			argType := con.GetType(args[0])
+			sized := target
+			if sized == nil {
+				sized = args[0]
+			}
+			argType := con.GetType(sized)
 			switch {
 			case IsStringType(argType), IsBytesType(argType):
 				sqlFun = "LENGTH"
@@ -664,7 +1879,7 @@ func (con *Converter) visitCallFunc(expr *exprpb.Expr) error {
 				return fmt.Errorf("unsupported type: %v", argType)
 			}
 		} else {
-			sqlFun = strings.ToUpper(fun)
+			sqlFun = sqlFunctionName(fun)
 		}
 	}
 	con.str.WriteString(sqlFun)
@@ -711,7 +1926,11 @@ func isNullTimestamp(expr *exprpb.Expr) bool {
 }
 
 func (con *Converter) visitCallIndex(expr *exprpb.Expr) error {
-	if IsMapType(con.GetType(expr.GetCallExpr().GetArgs()[0])) {
+	operandType := con.GetType(expr.GetCallExpr().GetArgs()[0])
+	if isOptionalType(operandType) {
+		return con.visitCallOptIndex(expr)
+	}
+	if IsMapType(operandType) {
 		return con.visitCallMapIndex(expr)
 	}
 	return con.visitCallListIndex(expr)
@@ -729,9 +1948,11 @@ func (con *Converter) visitCallMapIndex(expr *exprpb.Expr) error {
 	if err != nil {
 		return err
 	}
-	con.str.WriteString(".`")
-	con.str.WriteString(fieldName)
-	con.str.WriteString("`")
+	if con.strictIdentifiers {
+		return fmt.Errorf("map key %q cannot be resolved in strict mode", fieldName)
+	}
+	con.str.WriteString(".")
+	con.str.WriteString(con.QuoteIdentifier(fieldName))
 	return nil
 }
 
@@ -765,6 +1986,72 @@ func (con *Converter) visitCallListGet(target *exprpb.Expr, args []*exprpb.Expr)
 	return nil
 }
 
+// callListDistinct removes duplicates from a list, keeping the first occurrences in order like ext.Lists.
+func (con *Converter) callListDistinct(target *exprpb.Expr) error {
+	con.str.WriteString("ARRAY(SELECT _v FROM UNNEST(")
+	if err := con.Visit(target); err != nil {
+		return err
+	}
+	con.str.WriteString(") AS _v WITH OFFSET AS _i GROUP BY _v ORDER BY MIN(_i))")
+	return nil
+}
+
+// callListFlatten concatenates the lists in a list literal, since BigQuery has no arrays of arrays.
+func (con *Converter) callListFlatten(target *exprpb.Expr) error {
+	list := target.GetListExpr()
+	if list == nil {
+		return fmt.Errorf("flatten() target must be a list literal")
+	}
+	if len(list.GetElements()) == 0 {
+		con.str.WriteString("[]")
+		return nil
+	}
+	con.str.WriteString("ARRAY_CONCAT(")
+	for i, elem := range list.GetElements() {
+		if i > 0 {
+			con.str.WriteString(", ")
+		}
+		if err := con.Visit(elem); err != nil {
+			return err
+		}
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+// callListSlice converts list.slice(start, end), whose end is exclusive.
+func (con *Converter) callListSlice(target *exprpb.Expr, args []*exprpb.Expr) error {
+	con.str.WriteString("ARRAY(SELECT _v FROM UNNEST(")
+	if err := con.Visit(target); err != nil {
+		return err
+	}
+	con.str.WriteString(") AS _v WITH OFFSET AS _i WHERE _i >= ")
+	if err := con.visitMaybeNested(args[0], isComplexOperatorWithRespectTo(operators.GreaterEquals, args[0])); err != nil {
+		return err
+	}
+	con.str.WriteString(" AND _i < ")
+	if err := con.visitMaybeNested(args[1], isComplexOperatorWithRespectTo(operators.Less, args[1])); err != nil {
+		return err
+	}
+	con.str.WriteString(" ORDER BY _i)")
+	return nil
+}
+
+// callListsRange converts lists.range(n) into the list of integers from 0 to n - 1.
+func (con *Converter) callListsRange(n *exprpb.Expr) error {
+	con.str.WriteString("GENERATE_ARRAY(0, ")
+	if c, ok := n.GetConstExpr().GetConstantKind().(*exprpb.Constant_Int64Value); ok {
+		con.str.WriteString(strconv.FormatInt(c.Int64Value-1, 10))
+		con.str.WriteString(")")
+		return nil
+	}
+	if err := con.visitMaybeNested(n, isComplexOperatorWithRespectTo(operators.Subtract, n)); err != nil {
+		return err
+	}
+	con.str.WriteString(" - 1)")
+	return nil
+}
+
 var standardSQLUnaryOperators = map[string]string{
 	operators.LogicalNot: "NOT ",
 }
@@ -804,12 +2091,18 @@ func (con *Converter) visitComprehension(expr *exprpb.Expr) error {
 	}
 
 	e := expr.GetComprehensionExpr()
-	con.pushComprehensionIterVar(e.GetIterVar())
+	var rel *Relationship
+	if _, r, ok := con.relatedRange(e.GetIterRange()); ok {
+		rel = &r
+	}
+	con.pushComprehensionIterVar(e.GetIterVar(), rel)
 	defer con.popComprehensionIterVar()
 
 	switch fn := f.GetFunction(); fn {
 	case "exists":
 		return con.visitExistComprehension(expr)
+	case "all":
+		return con.visitAllComprehension(expr)
 	case "map":
 		return con.visitMapComprehension(expr, false)
 	case "mapDistinct":
@@ -827,28 +2120,75 @@ func (con *Converter) visitComprehension(expr *exprpb.Expr) error {
 	}
 }
 
-func (con *Converter) pushComprehensionIterVar(v string) {
+// pushComprehensionIterVar enters the scope of the iteration variable v, where rel is non-nil if v is a row of a related table.
+func (con *Converter) pushComprehensionIterVar(v string, rel *Relationship) {
 	con.compIterVars = append(con.compIterVars, v)
+	con.compIterRels = append(con.compIterRels, rel)
 }
 
 func (con *Converter) popComprehensionIterVar() {
 	con.compIterVars = con.compIterVars[:len(con.compIterVars)-1]
+	con.compIterRels = con.compIterRels[:len(con.compIterRels)-1]
+}
+
+// comprehensionIterVarRelationship returns the relationship of the innermost iteration variable named v, if any.
+func (con *Converter) comprehensionIterVarRelationship(v string) *Relationship {
+	for i := len(con.compIterVars) - 1; i >= 0; i-- {
+		if con.compIterVars[i] == v {
+			return con.compIterRels[i]
+		}
+	}
+	return nil
 }
 
 func (con *Converter) visitExistComprehension(expr *exprpb.Expr) error {
 	e := expr.GetComprehensionExpr()
+	predicate := e.GetLoopStep().GetCallExpr().GetArgs()[1]
+	if chain, rel, ok := con.relatedRange(e.GetIterRange()); ok {
+		// EXISTS (SELECT * FROM table AS x WHERE x.foreign_key = local_key AND expr_sql(x))
+		con.str.WriteString("EXISTS (SELECT * FROM ")
+		if err := con.writeRelatedRange(chain, rel, e.GetIterVar(), predicate); err != nil {
+			return err
+		}
+		con.str.WriteString(")")
+		return nil
+	}
 	con.str.WriteString("EXISTS (SELECT * FROM UNNEST(")
 	if err := con.Visit(e.GetIterRange()); err != nil {
 		return err
 	}
 	con.str.WriteString(fmt.Sprintf(") AS %s WHERE ", e.GetIterVar()))
-	if err := con.Visit(e.GetLoopStep().GetCallExpr().GetArgs()[1]); err != nil {
+	if err := con.Visit(predicate); err != nil {
 		return err
 	}
 	con.str.WriteString(")")
 	return nil
 }
 
+func (con *Converter) visitAllComprehension(expr *exprpb.Expr) error {
+	e := expr.GetComprehensionExpr()
+	predicate := e.GetLoopStep().GetCallExpr().GetArgs()[1]
+	if chain, rel, ok := con.relatedRange(e.GetIterRange()); ok {
+		// NOT EXISTS (SELECT * FROM table AS x WHERE x.foreign_key = local_key AND NOT (expr_sql(x)))
+		con.str.WriteString("NOT EXISTS (SELECT * FROM ")
+		if err := con.writeRelatedRange(chain, rel, e.GetIterVar(), nil); err != nil {
+			return err
+		}
+		con.str.WriteString(" AND NOT (")
+	} else {
+		con.str.WriteString("NOT EXISTS (SELECT * FROM UNNEST(")
+		if err := con.Visit(e.GetIterRange()); err != nil {
+			return err
+		}
+		con.str.WriteString(fmt.Sprintf(") AS %s WHERE NOT (", e.GetIterVar()))
+	}
+	if err := con.Visit(predicate); err != nil {
+		return err
+	}
+	con.str.WriteString("))")
+	return nil
+}
+
 func (con *Converter) visitArrayIncludesComprehension(expr *exprpb.Expr) error {
 	e := expr.GetComprehensionExpr()
 	con.str.WriteString("ARRAY_INCLUDES(")
@@ -884,6 +2224,13 @@ func (con *Converter) visitMapComprehension(expr *exprpb.Expr, distinct bool) er
 		return fmt.Errorf("uknown opereator for map comprehension")
 	}
 	con.str.WriteString(" FROM ")
+	if chain, rel, ok := con.relatedRange(e.GetIterRange()); ok {
+		if err := con.writeRelatedRange(chain, rel, e.GetIterVar(), filter); err != nil {
+			return err
+		}
+		con.str.WriteString(")")
+		return nil
+	}
 	if err := con.Visit(e.GetIterRange()); err != nil {
 		return err
 	}
@@ -919,12 +2266,24 @@ func (con *Converter) visitArrayTransformComprehension(expr *exprpb.Expr) error
 
 func (con *Converter) visitFilterComprehension(expr *exprpb.Expr) error {
 	e := expr.GetComprehensionExpr()
+	predicate := e.GetLoopStep().GetCallExpr().GetArgs()[0]
 	con.str.WriteString(fmt.Sprintf("ARRAY(SELECT %s FROM ", e.GetIterVar()))
+	if chain, rel, ok := con.relatedRange(e.GetIterRange()); ok {
+		// the whole rows are selected
+		if err := con.authorizeRelatedRow(rel); err != nil {
+			return err
+		}
+		if err := con.writeRelatedRange(chain, rel, e.GetIterVar(), predicate); err != nil {
+			return err
+		}
+		con.str.WriteString(")")
+		return nil
+	}
 	if err := con.Visit(e.GetIterRange()); err != nil {
 		return err
 	}
 	con.str.WriteString(fmt.Sprintf(" AS %s WHERE ", e.GetIterVar()))
-	if err := con.Visit(e.GetLoopStep().GetCallExpr().GetArgs()[0]); err != nil {
+	if err := con.Visit(predicate); err != nil {
 		return err
 	}
 	con.str.WriteString(")")
@@ -984,11 +2343,16 @@ func (con *Converter) visitConst(expr *exprpb.Expr) error {
 	if err != nil {
 		return err
 	}
-	con.WriteValue(value)
+	con.WriteTypedValue(value, con.GetType(expr))
 	return nil
 }
 
 func (con *Converter) visitIdent(expr *exprpb.Expr) error {
+	if isDatePartType(con.GetType(expr)) {
+		// date parts like DAY are SQL keywords, not columns
+		con.str.WriteString(expr.GetIdentExpr().GetName())
+		return nil
+	}
 	path := []string{expr.GetIdentExpr().GetName()}
 	return con.WriteIdent(nil, path)
 }
@@ -997,6 +2361,13 @@ func (con *Converter) visitList(expr *exprpb.Expr) error {
 	// TODO: implement list support
 	l := expr.GetListExpr()
 	elems := l.GetElements()
+	if _, ok := con.valueTracker.(TypedValueTracker); ok {
+		// bind a constant list as a single array parameter, which needs its element type when empty
+		if values, ok := constantListValues(elems); ok {
+			con.WriteTypedValue(values, con.GetType(expr))
+			return nil
+		}
+	}
 	con.str.WriteString("[")
 	for i, elem := range elems {
 		err := con.Visit(elem)
@@ -1011,6 +2382,30 @@ func (con *Converter) visitList(expr *exprpb.Expr) error {
 	return nil
 }
 
+// constantListValues returns the values of elems if all of them are non-NULL constants of the same type,
+// since an array parameter cannot contain NULL.
+func constantListValues(elems []*exprpb.Expr) ([]interface{}, bool) {
+	values := make([]interface{}, 0, len(elems))
+	for _, elem := range elems {
+		c := elem.GetConstExpr()
+		if c == nil {
+			return nil, false
+		}
+		if _, ok := c.GetConstantKind().(*exprpb.Constant_NullValue); ok {
+			return nil, false
+		}
+		val, err := GetConstValue(elem)
+		if err != nil {
+			return nil, false
+		}
+		if len(values) > 0 && reflect.TypeOf(val) != reflect.TypeOf(values[0]) {
+			return nil, false
+		}
+		values = append(values, val)
+	}
+	return values, true
+}
+
 func (con *Converter) visitSelect(expr *exprpb.Expr) error {
 	// combine nested selects like a.b.c to track them together
 	var rootExpr *exprpb.Expr
@@ -1019,6 +2414,9 @@ func (con *Converter) visitSelect(expr *exprpb.Expr) error {
 		if ee := e.GetSelectExpr(); ee != nil {
 			path = append(path, ee.GetField())
 			e = ee.GetOperand()
+		} else if operand, field, ok := optionalSelect(e); ok {
+			path = append(path, field)
+			e = operand
 		} else if ee := e.GetIdentExpr(); ee != nil {
 			path = append(path, ee.GetName())
 			break
@@ -1030,6 +2428,21 @@ func (con *Converter) visitSelect(expr *exprpb.Expr) error {
 
 	sel := expr.GetSelectExpr()
 
+	if con.fieldMapping != nil {
+		if mapped, err := con.visitMappedSelect(expr, rootExpr, path); mapped || err != nil {
+			return err
+		}
+	}
+	if con.strictIdentifiers {
+		if err := con.checkResolvedSelect(expr); err != nil {
+			return err
+		}
+	}
+	if con.relationships != nil {
+		if related, err := con.visitRelatedSelect(expr); related || err != nil {
+			return err
+		}
+	}
 	if rootExpr != nil {
 		nested := !sel.GetTestOnly() && isBinaryOrTernaryOperator(rootExpr)
 		err := con.visitMaybeNested(rootExpr, nested)
@@ -1039,7 +2452,9 @@ func (con *Converter) visitSelect(expr *exprpb.Expr) error {
 	}
 
 	reverse(path)
-	con.WriteIdent(rootExpr, path)
+	if err := con.WriteIdent(rootExpr, path); err != nil {
+		return err
+	}
 
 	// handle the case when the select expression was generated by the has() macro.
 	if sel.GetTestOnly() {
@@ -1048,6 +2463,123 @@ func (con *Converter) visitSelect(expr *exprpb.Expr) error {
 	return nil
 }
 
+// visitMappedSelect writes a.b.c as the SQL expression of the first mapped field in the path,
+// followed by the rest of the path. path is in the reverse order.
+func (con *Converter) visitMappedSelect(expr *exprpb.Expr, rootExpr *exprpb.Expr, path []string) (bool, error) {
+	var operands []*exprpb.Expr
+	for e := expr; ; {
+		if ee := e.GetSelectExpr(); ee != nil {
+			e = ee.GetOperand()
+		} else if operand, _, ok := optionalSelect(e); ok {
+			e = operand
+		} else {
+			break
+		}
+		operands = append(operands, e)
+	}
+	index, field := con.mappedField(operands, path)
+	if index < 0 {
+		return false, nil
+	}
+	if con.relationships != nil {
+		if i, _ := con.relationship(operands, path); i > index {
+			// the field is mapped in the related table, which visitRelatedSelect writes
+			return false, nil
+		} else if i >= 0 {
+			return true, fmt.Errorf("relationship %q cannot be selected from mapped field %q", path[i], path[index])
+		}
+	}
+	celPath := append([]string{}, path...)
+	reverse(celPath)
+	if rootExpr != nil || con.isComprehensionIterVarAccess(celPath) {
+		return true, fmt.Errorf("mapped field %q cannot be selected from an expression", path[index])
+	}
+	if con.identAuthorizer != nil {
+		authorize := func(path []string) (string, error) {
+			return con.identAuthorizer.AuthorizeIdentAccess(nil, path)
+		}
+		masked, err := con.authorizeMappedField(celPath[:len(path)-index-1], field, authorize)
+		if err != nil {
+			return true, err
+		}
+		if masked != "" {
+			if index > 0 {
+				return true, fmt.Errorf("cannot select %q from masked field %q", strings.Join(celPath, "."), path[index])
+			}
+			con.str.WriteString(masked)
+			return true, nil
+		}
+	}
+	con.writeMappedField(field, path[:index])
+	if expr.GetSelectExpr().GetTestOnly() {
+		con.str.WriteString(" IS NOT NULL")
+	}
+	return true, nil
+}
+
+// mappedField finds the mapped field nearest to the root, returning its index in the path from the leaf.
+func (con *Converter) mappedField(operands []*exprpb.Expr, fields []string) (int, MappedField) {
+	for i := len(operands) - 1; i >= 0; i-- {
+		msgType := unwrapOptionalType(con.GetType(operands[i])).GetMessageType()
+		if f, ok := con.fieldMapping.Lookup(msgType, fields[i]); ok {
+			return i, f
+		}
+	}
+	return -1, MappedField{}
+}
+
+// writeMappedField writes the SQL of field followed by the fields selected from it, which are in the reverse order.
+func (con *Converter) writeMappedField(field MappedField, fields []string) {
+	con.str.WriteString("(")
+	con.str.WriteString(field.SQL)
+	con.str.WriteString(")")
+	for i := len(fields) - 1; i >= 0; i-- {
+		con.str.WriteString(".")
+		con.str.WriteString(con.QuoteIdentifier(fields[i]))
+	}
+}
+
+// authorizeMappedField authorizes the columns which the SQL of field reads by authorize, where parent is the path of
+// its message. If any of them is masked, the mask is written instead of the whole field.
+func (con *Converter) authorizeMappedField(parent []string, field MappedField, authorize func(path []string) (string, error)) (string, error) {
+	if len(field.Columns) == 0 {
+		// the SQL may read any column of the message
+		return authorize(parent)
+	}
+	masked := ""
+	for _, column := range field.Columns {
+		path := append(parent[:len(parent):len(parent)], strings.Split(column, ".")...)
+		m, err := authorize(path)
+		if err != nil {
+			return "", err
+		}
+		if masked == "" {
+			masked = m
+		}
+	}
+	return masked, nil
+}
+
+// checkResolvedSelect ensures that every field of a.b.c is selected from a message type,
+// which means the type provider resolved it, rather than from a map or dyn.
+func (con *Converter) checkResolvedSelect(expr *exprpb.Expr) error {
+	for e := expr; ; {
+		var operand *exprpb.Expr
+		var field string
+		if ee := e.GetSelectExpr(); ee != nil {
+			operand, field = ee.GetOperand(), ee.GetField()
+		} else if o, f, ok := optionalSelect(e); ok {
+			operand, field = o, f
+		} else {
+			return nil
+		}
+		if unwrapOptionalType(con.GetType(operand)).GetMessageType() == "" {
+			return fmt.Errorf("field %q cannot be resolved in strict mode", field)
+		}
+		e = operand
+	}
+}
+
 func (con *Converter) visitStruct(expr *exprpb.Expr) error {
 	s := expr.GetStructExpr()
 	// If the message name is non-empty, then this should be treated as message construction.
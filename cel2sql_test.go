@@ -1,10 +1,13 @@
 package cel2sql_test
 
 import (
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
 	"github.com/google/cel-go/cel"
 	"github.com/google/cel-go/checker/decls"
 	"github.com/stretchr/testify/assert"
@@ -21,6 +24,8 @@ import (
 func TestConvert(t *testing.T) {
 	env, err := cel.NewEnv(
 		ext.Strings(),
+		ext.Math(),
+		cel.OptionalTypes(),
 		cel.EnableMacroCallTracking(),
 		sqltypes.AdditionalMacros,
 		cel.CustomTypeProvider(bq.NewTypeProvider(map[string]bigquery.Schema{
@@ -33,6 +38,7 @@ func TestConvert(t *testing.T) {
 			decls.NewVar("age", decls.Int),
 			decls.NewVar("adult", decls.Bool),
 			decls.NewVar("height", decls.Double),
+			decls.NewVar("scores", decls.NewListType(decls.Double)),
 			decls.NewVar("string_list", decls.NewListType(decls.String)),
 			decls.NewVar("string_int_map", decls.NewMapType(decls.String, decls.Int)),
 			decls.NewVar("nullable_string", decls.NewWrapperType(decls.String)),
@@ -43,6 +49,8 @@ func TestConvert(t *testing.T) {
 			decls.NewVar("fixed_time", sqltypes.Time),
 			decls.NewVar("scheduled_at", sqltypes.DateTime),
 			decls.NewVar("created_at", decls.Timestamp),
+			decls.NewVar("retention", decls.Duration),
+			decls.NewVar("retention_text", decls.String),
 			decls.NewVar("trigram", decls.NewObjectType("trigrams")),
 			decls.NewVar("page", decls.NewObjectType("wikipedia")),
 			decls.NewVar("pages", decls.NewListType(decls.NewObjectType("wikipedia"))),
@@ -260,12 +268,12 @@ func TestConvert(t *testing.T) {
 		{
 			name: "time",
 			args: args{source: `fixed_time == time("18:00:00")`},
-			want: "`fixed_time` = TIME(\"18:00:00\")",
+			want: "`fixed_time` = TIME \"18:00:00\"",
 		},
 		{
 			name: "datetime",
 			args: args{source: `scheduled_at != datetime(date("2021-09-01"), fixed_time)`},
-			want: "`scheduled_at` != DATETIME(DATE(\"2021-09-01\"), `fixed_time`)",
+			want: "`scheduled_at` != DATETIME(DATE \"2021-09-01\", `fixed_time`)",
 		},
 		{
 			name: "null_timestamp",
@@ -280,7 +288,7 @@ func TestConvert(t *testing.T) {
 		{
 			name: "timestamp",
 			args: args{source: `created_at - duration("60m") <= timestamp(datetime("2021-09-01 18:00:00"), "Asia/Tokyo")`},
-			want: "TIMESTAMP_SUB(`created_at`, INTERVAL 1 HOUR) <= TIMESTAMP(DATETIME(\"2021-09-01 18:00:00\"), \"Asia/Tokyo\")",
+			want: "TIMESTAMP_SUB(`created_at`, INTERVAL 1 HOUR) <= TIMESTAMP(DATETIME \"2021-09-01 18:00:00\", \"Asia/Tokyo\")",
 		},
 		{
 			name: "duration_second",
@@ -297,6 +305,126 @@ func TestConvert(t *testing.T) {
 			args: args{source: `duration("60m")`},
 			want: "INTERVAL 1 HOUR",
 		},
+		{
+			name: "duration_day",
+			args: args{source: `duration("7d")`},
+			want: "INTERVAL 7 DAY",
+		},
+		{
+			name: "duration_week",
+			args: args{source: `duration("2w")`},
+			want: "INTERVAL 14 DAY",
+		},
+		{
+			name: "duration_month",
+			args: args{source: `duration("3mo")`},
+			want: "INTERVAL 3 MONTH",
+		},
+		{
+			name: "duration_year",
+			args: args{source: `duration("1y")`},
+			want: "INTERVAL 1 YEAR",
+		},
+		{
+			name: "duration_compound_calendar",
+			args: args{source: `duration("1y2mo3d4h5m6s")`},
+			want: "MAKE_INTERVAL(1, 2, 3, 4, 5, 6)",
+		},
+		{
+			name: "duration_negative_calendar",
+			args: args{source: `duration("-1w12h")`},
+			want: "MAKE_INTERVAL(0, 0, -7, -12, 0, 0)",
+		},
+		{
+			name:    "duration_calendar_subsecond",
+			args:    args{source: `duration("1d1ms")`},
+			wantErr: true,
+		},
+		{
+			name:    "duration_fractional_day",
+			args:    args{source: `duration("1.5d")`},
+			wantErr: true,
+		},
+		{
+			name:    "duration_unknown_unit",
+			args:    args{source: `duration("1fortnight")`},
+			wantErr: true,
+		},
+		{
+			name: "duration_timestamp_sub",
+			args: args{source: `created_at > current_timestamp() - duration("30d")`},
+			want: "`created_at` > TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL 30 DAY)",
+		},
+		{
+			name: "duration_timestamp_sub_month",
+			args: args{source: `created_at > current_timestamp() - duration("3mo")`},
+			want: "`created_at` > TIMESTAMP(DATETIME_SUB(DATETIME(CURRENT_TIMESTAMP()), INTERVAL 3 MONTH))",
+		},
+		{
+			name: "duration_timestamp_add_compound",
+			args: args{source: `created_at + duration("1d12h")`},
+			want: "`created_at` + MAKE_INTERVAL(0, 0, 1, 12, 0, 0)",
+		},
+		{
+			name: "duration_timestamp_sub_compound_month",
+			args: args{source: `created_at - duration("1y1d")`},
+			want: "TIMESTAMP(DATETIME(`created_at`) - MAKE_INTERVAL(1, 0, 1, 0, 0, 0))",
+		},
+		{
+			name: "duration_date_sub_month",
+			args: args{source: `birthday - duration("1mo")`},
+			want: "DATE_SUB(`birthday`, INTERVAL 1 MONTH)",
+		},
+		{
+			name: "duration_date_add_compound",
+			args: args{source: `birthday + duration("1mo15d")`},
+			want: "DATE(`birthday` + MAKE_INTERVAL(0, 1, 15, 0, 0, 0))",
+		},
+		{
+			name:    "duration_date_add_clock",
+			args:    args{source: `birthday + duration("1d12h")`},
+			wantErr: true,
+		},
+		{
+			name: "duration_var",
+			args: args{source: `created_at > current_timestamp() - duration(retention)`},
+			want: "`created_at` > TIMESTAMP_SUB(CURRENT_TIMESTAMP(), `retention`)",
+		},
+		{
+			name: "duration_string_var",
+			args: args{source: `created_at > current_timestamp() - duration(retention_text)`},
+			want: "`created_at` > TIMESTAMP_SUB(CURRENT_TIMESTAMP(), CAST(`retention_text` AS INTERVAL))",
+		},
+		{
+			name: "timestamp_diff_days",
+			args: args{source: `page.timestamp - created_at > duration("1d")`},
+			want: "TIMESTAMP_DIFF(`page`.`timestamp`, `created_at`, MICROSECOND) > 86400000000",
+		},
+		{
+			name: "timestamp_literal_offset",
+			args: args{source: `created_at < timestamp("2023-01-01T09:00:00.123+09:00")`},
+			want: "`created_at` < TIMESTAMP \"2023-01-01 00:00:00.123+00:00\"",
+		},
+		{
+			name: "datetime_literal_fraction",
+			args: args{source: `scheduled_at < datetime("2023-01-01T09:00:00.5")`},
+			want: "`scheduled_at` < DATETIME \"2023-01-01 09:00:00.5\"",
+		},
+		{
+			name:    "timestamp_literal_invalid",
+			args:    args{source: `created_at < timestamp("2023-13-01T00:00:00Z")`},
+			wantErr: true,
+		},
+		{
+			name:    "date_literal_invalid",
+			args:    args{source: `birthday == date("2023-02-30")`},
+			wantErr: true,
+		},
+		{
+			name:    "time_literal_invalid",
+			args:    args{source: `fixed_time == time("25:00:00")`},
+			wantErr: true,
+		},
 		{
 			name: "interval",
 			args: args{source: `interval(1, MONTH)`},
@@ -305,7 +433,7 @@ func TestConvert(t *testing.T) {
 		{
 			name: "date_add",
 			args: args{source: `date("2021-09-01") + interval(1, DAY)`},
-			want: `DATE_ADD(DATE("2021-09-01"), INTERVAL 1 DAY)`,
+			want: `DATE_ADD(DATE "2021-09-01", INTERVAL 1 DAY)`,
 		},
 		{
 			name: "date_sub",
@@ -315,17 +443,17 @@ func TestConvert(t *testing.T) {
 		{
 			name: "time_add",
 			args: args{source: `time("09:00:00") + interval(1, MINUTE)`},
-			want: `TIME_ADD(TIME("09:00:00"), INTERVAL 1 MINUTE)`,
+			want: `TIME_ADD(TIME "09:00:00", INTERVAL 1 MINUTE)`,
 		},
 		{
 			name: "time_sub",
 			args: args{source: `time("09:00:00") - interval(1, MINUTE)`},
-			want: `TIME_SUB(TIME("09:00:00"), INTERVAL 1 MINUTE)`,
+			want: `TIME_SUB(TIME "09:00:00", INTERVAL 1 MINUTE)`,
 		},
 		{
 			name: "datetime_add",
 			args: args{source: `datetime("2021-09-01 18:00:00") + interval(1, MINUTE)`},
-			want: `DATETIME_ADD(DATETIME("2021-09-01 18:00:00"), INTERVAL 1 MINUTE)`,
+			want: `DATETIME_ADD(DATETIME "2021-09-01 18:00:00", INTERVAL 1 MINUTE)`,
 		},
 		{
 			name: "datetime_sub",
@@ -335,13 +463,194 @@ func TestConvert(t *testing.T) {
 		{
 			name: "timestamp_add",
 			args: args{source: `duration("1h") + timestamp("2021-09-01T18:00:00Z")`},
-			want: `TIMESTAMP_ADD(TIMESTAMP("2021-09-01T18:00:00Z"), INTERVAL 1 HOUR)`,
+			want: `TIMESTAMP_ADD(TIMESTAMP "2021-09-01 18:00:00+00:00", INTERVAL 1 HOUR)`,
 		},
 		{
 			name: "timestamp_sub",
 			args: args{source: `created_at - interval(1, HOUR)`},
 			want: "TIMESTAMP_SUB(`created_at`, INTERVAL 1 HOUR)",
 		},
+		{
+			name: "timestamp_diff",
+			args: args{source: `page.timestamp - created_at > duration("30m")`},
+			want: "TIMESTAMP_DIFF(`page`.`timestamp`, `created_at`, MICROSECOND) > 1800000000",
+		},
+		{
+			name: "timestamp_diff_reversed",
+			args: args{source: `duration("1h") <= created_at - timestamp("2021-09-01T18:00:00Z")`},
+			want: `3600000000 <= TIMESTAMP_DIFF(` + "`created_at`" + `, TIMESTAMP "2021-09-01 18:00:00+00:00", MICROSECOND)`,
+		},
+		{
+			name: "timestamp_diff_add",
+			args: args{source: `created_at + (page.timestamp - created_at)`},
+			want: "TIMESTAMP_ADD(`created_at`, INTERVAL TIMESTAMP_DIFF(`page`.`timestamp`, `created_at`, MICROSECOND) MICROSECOND)",
+		},
+		{
+			name: "date_diff",
+			args: args{source: `current_date() - birthday >= duration("24h")`},
+			want: "DATE_DIFF(CURRENT_DATE(), `birthday`, DAY) * 86400000000 >= 86400000000",
+		},
+		{
+			name: "datetime_diff",
+			args: args{source: `current_datetime() - scheduled_at < duration("1s")`},
+			want: "DATETIME_DIFF(CURRENT_DATETIME(), `scheduled_at`, MICROSECOND) < 1000000",
+		},
+		{
+			name: "time_diff",
+			args: args{source: `fixed_time - time("09:00:00") == duration("1h")`},
+			want: "TIME_DIFF(`fixed_time`, TIME \"09:00:00\", MICROSECOND) = 3600000000",
+		},
+		{
+			name: "duration_getHours",
+			args: args{source: `(page.timestamp - created_at).getHours() >= 2`},
+			want: "DIV(TIMESTAMP_DIFF(`page`.`timestamp`, `created_at`, MICROSECOND), 3600000000) >= 2",
+		},
+		{
+			name: "duration_getMinutes",
+			args: args{source: `(current_date() - birthday).getMinutes()`},
+			want: "DIV(DATE_DIFF(CURRENT_DATE(), `birthday`, DAY) * 86400000000, 60000000)",
+		},
+		{
+			name: "duration_getSeconds",
+			args: args{source: `duration("90m").getSeconds()`},
+			want: "DIV(5400000000, 1000000)",
+		},
+		{
+			name: "timestamp_diff_duration_var",
+			args: args{source: `page.timestamp - created_at > retention`},
+			want: "TIMESTAMP_DIFF(`page`.`timestamp`, `created_at`, MICROSECOND) > UNIX_MICROS(TIMESTAMP \"1970-01-01 00:00:00+00:00\" + `retention`)",
+		},
+		{
+			name: "timestamp_diff_duration_string_var",
+			args: args{source: `page.timestamp - created_at <= duration(retention_text)`},
+			want: "TIMESTAMP_DIFF(`page`.`timestamp`, `created_at`, MICROSECOND) <= UNIX_MICROS(TIMESTAMP \"1970-01-01 00:00:00+00:00\" + CAST(`retention_text` AS INTERVAL))",
+		},
+		{
+			name: "duration_var_getHours",
+			args: args{source: `retention.getHours() < 24`},
+			want: "DIV(UNIX_MICROS(TIMESTAMP \"1970-01-01 00:00:00+00:00\" + `retention`), 3600000000) < 24",
+		},
+		{
+			name: "ago",
+			args: args{source: `created_at >= ago(duration("24h"))`},
+			want: "`created_at` >= TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL 24 HOUR)",
+		},
+		{
+			name: "ago_month_timezone",
+			args: args{source: `created_at >= ago(duration("3mo"), "Asia/Tokyo")`},
+			want: "`created_at` >= TIMESTAMP(DATETIME_SUB(DATETIME(CURRENT_TIMESTAMP(), \"Asia/Tokyo\"), INTERVAL 3 MONTH), \"Asia/Tokyo\")",
+		},
+		{
+			name:    "ago_clock_timezone",
+			args:    args{source: `created_at >= ago(duration("1h"), "Asia/Tokyo")`},
+			wantErr: true,
+		},
+		{
+			name:    "ago_days_timezone",
+			args:    args{source: `created_at >= ago(duration("7d"), "Asia/Tokyo")`},
+			wantErr: true,
+		},
+		{
+			name: "within_last",
+			args: args{source: `within_last(page.timestamp, duration("30m"))`},
+			want: "(`page`.`timestamp` >= TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL 30 MINUTE))",
+		},
+		{
+			name: "within_last_interval",
+			args: args{source: `within_last(created_at, interval(2, HOUR))`},
+			want: "(`created_at` >= TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL 2 HOUR))",
+		},
+		{
+			name: "within_last_date_timezone",
+			args: args{source: `within_last(birthday, duration("7d"), "Asia/Tokyo")`},
+			want: "(`birthday` >= DATE_SUB(CURRENT_DATE(\"Asia/Tokyo\"), INTERVAL 7 DAY))",
+		},
+		{
+			name: "within_last_interval_timezone",
+			args: args{source: `within_last(created_at, interval(1, MONTH), "Asia/Tokyo")`},
+			want: "(`created_at` >= TIMESTAMP(DATETIME_SUB(DATETIME(CURRENT_TIMESTAMP(), \"Asia/Tokyo\"), INTERVAL 1 MONTH), \"Asia/Tokyo\"))",
+		},
+		{
+			name: "within_last_compared",
+			args: args{source: `within_last(created_at, duration("1h")) == adult`},
+			want: "(`created_at` >= TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL 1 HOUR)) = `adult`",
+		},
+		{
+			name:    "within_last_clock_timezone",
+			args:    args{source: `within_last(created_at, interval(2, HOUR), "Asia/Tokyo")`},
+			wantErr: true,
+		},
+		{
+			name:    "within_last_date_hours",
+			args:    args{source: `within_last(birthday, duration("24h"))`},
+			wantErr: true,
+		},
+		{
+			name:    "within_last_date_interval_hours",
+			args:    args{source: `within_last(birthday, interval(3, HOUR))`},
+			wantErr: true,
+		},
+		{
+			name: "today",
+			args: args{source: `created_at >= today()`},
+			want: "`created_at` >= TIMESTAMP_TRUNC(CURRENT_TIMESTAMP(), DAY)",
+		},
+		{
+			name: "today_timezone",
+			args: args{source: `created_at >= today("Asia/Tokyo")`},
+			want: "`created_at` >= TIMESTAMP_TRUNC(CURRENT_TIMESTAMP(), DAY, \"Asia/Tokyo\")",
+		},
+		{
+			name: "start_of",
+			args: args{source: `start_of(created_at, WEEK) == start_of(current_timestamp(), WEEK, "Asia/Tokyo")`},
+			want: "TIMESTAMP_TRUNC(`created_at`, WEEK) = TIMESTAMP_TRUNC(CURRENT_TIMESTAMP(), WEEK, \"Asia/Tokyo\")",
+		},
+		{
+			name: "start_of_date",
+			args: args{source: `start_of(birthday, MONTH)`},
+			want: "DATE_TRUNC(`birthday`, MONTH)",
+		},
+		{
+			name: "between",
+			args: args{source: `between(created_at, ago(duration("2h")), ago(duration("1h")))`},
+			want: "(`created_at` BETWEEN TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL 2 HOUR) AND TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL 1 HOUR))",
+		},
+		{
+			name: "between_int",
+			args: args{source: `between(age + 1, 18, 65)`},
+			want: "((`age` + 1) BETWEEN 18 AND 65)",
+		},
+		{
+			name: "between_compared",
+			args: args{source: `between(age, 1, 2) == adult`},
+			want: "(`age` BETWEEN 1 AND 2) = `adult`",
+		},
+		{
+			name: "now_timestamp",
+			args: args{source: `created_at >= current_timestamp() - duration("1h") && created_at < current_timestamp()`},
+			want: "`created_at` >= TIMESTAMP_SUB(TIMESTAMP \"2023-01-02 03:04:05.678901+00:00\", INTERVAL 1 HOUR) AND `created_at` < TIMESTAMP \"2023-01-02 03:04:05.678901+00:00\"",
+			options: []cel2sql.ConvertOption{
+				cel2sql.WithNow(time.Date(2023, 1, 2, 12, 4, 5, 678901234, time.FixedZone("JST", 9*60*60))),
+			},
+		},
+		{
+			name: "now_granularity",
+			args: args{source: `birthday == current_date("Asia/Tokyo") && scheduled_at < current_datetime() && fixed_time > current_time()`},
+			want: "`birthday` = DATE(TIMESTAMP \"2023-01-02 03:00:00+00:00\", \"Asia/Tokyo\") AND `scheduled_at` < DATETIME(TIMESTAMP \"2023-01-02 03:00:00+00:00\") AND `fixed_time` > TIME(TIMESTAMP \"2023-01-02 03:00:00+00:00\")",
+			options: []cel2sql.ConvertOption{
+				cel2sql.WithNow(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)),
+				cel2sql.WithNowGranularity(time.Hour),
+			},
+		},
+		{
+			name: "now_helpers",
+			args: args{source: `within_last(created_at, duration("1d")) && created_at >= today("Asia/Tokyo")`},
+			want: "(`created_at` >= TIMESTAMP_SUB(TIMESTAMP \"2023-01-02 03:04:00+00:00\", INTERVAL 1 DAY)) AND `created_at` >= TIMESTAMP_TRUNC(TIMESTAMP \"2023-01-02 03:04:00+00:00\", DAY, \"Asia/Tokyo\")",
+			options: []cel2sql.ConvertOption{
+				cel2sql.WithNow(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)),
+				cel2sql.WithNowGranularity(time.Minute),
+			},
+		},
 		{
 			name: "timestamp_getSeconds",
 			args: args{source: `created_at.getSeconds()`},
@@ -350,7 +659,288 @@ func TestConvert(t *testing.T) {
 		{
 			name: "\"timestamp_getHours_withTimezone",
 			args: args{source: `created_at.getHours("Asia/Tokyo")`},
-			want: "EXTRACT(HOUR FROM `created_at` AT \"Asia/Tokyo\")",
+			want: "EXTRACT(HOUR FROM `created_at` AT TIME ZONE \"Asia/Tokyo\")",
+		},
+		{
+			name: "default_timezone_getters",
+			args: args{source: `created_at.getHours() == 9 && created_at.getDayOfWeek("UTC") == 1 && birthday.getFullYear() == 2000`},
+			want: "EXTRACT(HOUR FROM `created_at` AT TIME ZONE \"Asia/Tokyo\") = 9 AND EXTRACT(DAYOFWEEK FROM `created_at` AT TIME ZONE \"UTC\") - 1 = 1 AND EXTRACT(YEAR FROM `birthday`) = 2000",
+			options: []cel2sql.ConvertOption{
+				cel2sql.WithTimeZone("Asia/Tokyo"),
+			},
+		},
+		{
+			name: "default_timezone_conversions",
+			args: args{source: `date(created_at) == current_date() && datetime(created_at) > current_datetime() && time(created_at) < current_time("UTC")`},
+			want: "DATE(`created_at`, \"Asia/Tokyo\") = CURRENT_DATE(\"Asia/Tokyo\") AND DATETIME(`created_at`, \"Asia/Tokyo\") > CURRENT_DATETIME(\"Asia/Tokyo\") AND TIME(`created_at`, \"Asia/Tokyo\") < CURRENT_TIME(\"UTC\")",
+			options: []cel2sql.ConvertOption{
+				cel2sql.WithTimeZone("Asia/Tokyo"),
+			},
+		},
+		{
+			name: "default_timezone_trunc",
+			args: args{source: `created_at.trunc(DAY) == today() && birthday.trunc(MONTH) == date(created_at, "UTC") && created_at.trunc(HOUR, "UTC") > ago(duration("1mo"))`},
+			want: "TIMESTAMP_TRUNC(`created_at`, DAY, \"Asia/Tokyo\") = TIMESTAMP_TRUNC(CURRENT_TIMESTAMP(), DAY, \"Asia/Tokyo\") AND DATE_TRUNC(`birthday`, MONTH) = DATE(`created_at`, \"UTC\") AND TIMESTAMP_TRUNC(`created_at`, HOUR, \"UTC\") > TIMESTAMP(DATETIME_SUB(DATETIME(CURRENT_TIMESTAMP(), \"Asia/Tokyo\"), INTERVAL 1 MONTH), \"Asia/Tokyo\")",
+			options: []cel2sql.ConvertOption{
+				cel2sql.WithTimeZone("Asia/Tokyo"),
+			},
+		},
+		{
+			name: "default_timezone_now",
+			args: args{source: `date(created_at) == current_date()`},
+			want: "DATE(`created_at`, \"America/New_York\") = DATE(TIMESTAMP \"2023-01-02 03:04:05+00:00\", \"America/New_York\")",
+			options: []cel2sql.ConvertOption{
+				cel2sql.WithTimeZone("America/New_York"),
+				cel2sql.WithNow(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)),
+			},
+		},
+		{
+			name: "coerce_string_literals",
+			args: args{source: `birthday <= "2024-01-01" && "2024-01-01 12:00:00" < scheduled_at && created_at >= "2024-01-01T00:00:00Z" && fixed_time > "09:00:00"`},
+			want: "`birthday` <= DATE \"2024-01-01\" AND DATETIME \"2024-01-01 12:00:00\" < `scheduled_at` AND `created_at` >= TIMESTAMP \"2024-01-01 00:00:00+00:00\" AND `fixed_time` > TIME \"09:00:00\"",
+		},
+		{
+			name: "coerce_equality_string_literals",
+			args: args{source: `birthday == "2024-01-01" && "2024-01-01 12:00:00" != scheduled_at && "2024-01-01T00:00:00Z" == created_at && fixed_time != "09:00:00"`},
+			want: "`birthday` = DATE \"2024-01-01\" AND DATETIME \"2024-01-01 12:00:00\" != `scheduled_at` AND TIMESTAMP \"2024-01-01 00:00:00+00:00\" = `created_at` AND `fixed_time` != TIME \"09:00:00\"",
+		},
+		{
+			name: "coerce_equality_date_literals",
+			args: args{source: `created_at == date("2024-01-01") && date("2024-01-01") != scheduled_at && birthday == timestamp("2024-01-01T00:00:00Z")`},
+			want: "`created_at` = TIMESTAMP(DATE \"2024-01-01\") AND DATETIME(DATE \"2024-01-01\") != `scheduled_at` AND `birthday` = DATE(TIMESTAMP \"2024-01-01 00:00:00+00:00\")",
+		},
+		{
+			name: "coerce_equality_dyn",
+			args: args{source: `dyn(created_at) == birthday && scheduled_at != dyn(name)`},
+			want: "`created_at` = TIMESTAMP(`birthday`) AND `scheduled_at` != CAST(`name` AS DATETIME)",
+		},
+		{
+			name:    "coerce_equality_invalid_string_literal",
+			args:    args{source: `birthday == "2024-13-01"`},
+			wantErr: true,
+		},
+		{
+			name:    "coerce_invalid_string_literal",
+			args:    args{source: `birthday >= "2024-13-01"`},
+			wantErr: true,
+		},
+		{
+			name: "coerce_string",
+			args: args{source: `birthday <= name && name == "2024-01-01"`},
+			want: "`birthday` <= CAST(`name` AS DATE) AND `name` = \"2024-01-01\"",
+		},
+		{
+			name: "coerce_constant_timestamp",
+			args: args{source: `birthday >= timestamp("2024-01-01T00:00:00Z") && scheduled_at < current_timestamp() && birthday < timestamp("2024-01-01T00:00:00Z")`},
+			want: "`birthday` >= DATE(TIMESTAMP \"2024-01-01 00:00:00+00:00\", \"Asia/Tokyo\") AND `scheduled_at` < DATETIME(CURRENT_TIMESTAMP(), \"Asia/Tokyo\") AND `birthday` < DATE(TIMESTAMP \"2024-01-01 00:00:00+00:00\", \"Asia/Tokyo\")",
+			options: []cel2sql.ConvertOption{
+				cel2sql.WithTimeZone("Asia/Tokyo"),
+			},
+		},
+		{
+			name: "coerce_columns",
+			args: args{source: `birthday < created_at && created_at > scheduled_at && scheduled_at >= birthday && datetime("2024-01-01 00:00:00") > birthday`},
+			want: "TIMESTAMP(`birthday`) < `created_at` AND `created_at` > TIMESTAMP(`scheduled_at`) AND `scheduled_at` >= DATETIME(`birthday`) AND DATE(DATETIME \"2024-01-01 00:00:00\") > `birthday`",
+		},
+		{
+			name: "date_functions",
+			args: args{source: `date_diff(birthday, date("2000-01-01"), YEAR) > 18 && last_day(birthday, MONTH) == date_from_unix_date(19000) && unix_date(date_bucket(birthday, duration("7d"))) > 0`},
+			want: "DATE_DIFF(`birthday`, DATE \"2000-01-01\", YEAR) > 18 AND LAST_DAY(`birthday`, MONTH) = DATE_FROM_UNIX_DATE(19000) AND UNIX_DATE(DATE_BUCKET(`birthday`, INTERVAL 7 DAY)) > 0",
+		},
+		{
+			name: "date_format_parse",
+			args: args{source: `format_date("%Y%m%d", birthday) == "20000101" && parse_date("%Y%m%d", name) < birthday && format_datetime("%c", scheduled_at) != format_time("%R", fixed_time)`},
+			want: "FORMAT_DATE(\"%Y%m%d\", `birthday`) = \"20000101\" AND PARSE_DATE(\"%Y%m%d\", `name`) < `birthday` AND FORMAT_DATETIME(\"%c\", `scheduled_at`) != FORMAT_TIME(\"%R\", `fixed_time`)",
+		},
+		{
+			name: "date_add_sub_functions",
+			args: args{source: `date_add(birthday, duration("1y")) < date_sub(current_date(), interval(1, DAY)) && timestamp_add(created_at, duration("1h")) > timestamp_sub(current_timestamp(), duration("1mo"))`},
+			want: "DATE_ADD(`birthday`, INTERVAL 1 YEAR) < DATE_SUB(CURRENT_DATE(), INTERVAL 1 DAY) AND TIMESTAMP_ADD(`created_at`, INTERVAL 1 HOUR) > TIMESTAMP(DATETIME_SUB(DATETIME(CURRENT_TIMESTAMP()), INTERVAL 1 MONTH))",
+		},
+		{
+			name: "date_trunc_functions",
+			args: args{source: `date_trunc(birthday, MONTH) == date("2024-01-01") && datetime_trunc(scheduled_at, MONTH) == scheduled_at && time_trunc(fixed_time, HOUR) == time("09:00:00") && timestamp_trunc(created_at, DAY) < timestamp_trunc(created_at, WEEK, "UTC")`},
+			want: "DATE_TRUNC(`birthday`, MONTH) = DATE \"2024-01-01\" AND DATETIME_TRUNC(`scheduled_at`, MONTH) = `scheduled_at` AND TIME_TRUNC(`fixed_time`, HOUR) = TIME \"09:00:00\" AND TIMESTAMP_TRUNC(`created_at`, DAY) < TIMESTAMP_TRUNC(`created_at`, WEEK, \"UTC\")",
+		},
+		{
+			name: "timestamp_functions",
+			args: args{source: `timestamp_diff(current_timestamp(), created_at, HOUR) < 24 && unix_millis(created_at) > 0 && timestamp_seconds(age) < timestamp_millis(unix_micros(created_at)) && datetime_diff(scheduled_at, datetime(created_at), MINUTE) > time_diff(fixed_time, time("09:00:00"), SECOND)`},
+			want: "TIMESTAMP_DIFF(CURRENT_TIMESTAMP(), `created_at`, HOUR) < 24 AND UNIX_MILLIS(`created_at`) > 0 AND TIMESTAMP_SECONDS(`age`) < TIMESTAMP_MILLIS(UNIX_MICROS(`created_at`)) AND DATETIME_DIFF(`scheduled_at`, DATETIME(`created_at`), MINUTE) > TIME_DIFF(`fixed_time`, TIME \"09:00:00\", SECOND)",
+		},
+		{
+			name: "timestamp_format_parse",
+			args: args{source: `format_timestamp("%F", created_at) == "2024-01-01" && parse_timestamp("%F %T", name, "UTC") < created_at && timestamp_bucket(created_at, duration("15m"), parse_timestamp("%F", "2024-01-01")) == created_at`},
+			want: "FORMAT_TIMESTAMP(\"%F\", `created_at`, \"Asia/Tokyo\") = \"2024-01-01\" AND PARSE_TIMESTAMP(\"%F %T\", `name`, \"UTC\") < `created_at` AND TIMESTAMP_BUCKET(`created_at`, INTERVAL 15 MINUTE, PARSE_TIMESTAMP(\"%F\", \"2024-01-01\", \"Asia/Tokyo\")) = `created_at`",
+			options: []cel2sql.ConvertOption{
+				cel2sql.WithTimeZone("Asia/Tokyo"),
+			},
+		},
+		{
+			name: "generate_date_array",
+			args: args{source: `birthday in generate_date_array(date("2000-01-01"), current_date(), duration("1w")) && created_at in generate_timestamp_array(timestamp("2024-01-01T00:00:00Z"), current_timestamp(), interval(1, HOUR))`},
+			want: "`birthday` IN UNNEST(GENERATE_DATE_ARRAY(DATE \"2000-01-01\", CURRENT_DATE(), INTERVAL 7 DAY)) AND `created_at` IN UNNEST(GENERATE_TIMESTAMP_ARRAY(TIMESTAMP \"2024-01-01 00:00:00+00:00\", CURRENT_TIMESTAMP(), INTERVAL 1 HOUR))",
+		},
+		{
+			name: "math_rounding",
+			args: args{source: `round(height, 2) >= 0.75 && round(height) == ceil(height) && floor(height) < trunc(height, 1) && trunc(height) > 0.0`},
+			want: "ROUND(`height`, 2) >= 0.75 AND ROUND(`height`) = CEIL(`height`) AND FLOOR(`height`) < TRUNC(`height`, 1) AND TRUNC(`height`) > 0",
+		},
+		{
+			name: "math_functions",
+			args: args{source: `abs(age - 30) < 5 && sign(height) == 1.0 && sqrt(age) > pow(height, 2.0) && log(height, 2.0) < ln(height) + log10(age) + exp(height)`},
+			want: "ABS(`age` - 30) < 5 AND SIGN(`height`) = 1 AND SQRT(`age`) > POW(`height`, 2) AND LOG(`height`, 2) < LN(`height`) + LOG10(`age`) + EXP(`height`)",
+		},
+		{
+			name: "math_division",
+			args: args{source: `safe_divide(age, 0) > ieee_divide(height, 0.0) && div(age, 10) == 2 && safe_add(age, 1) > safe_negate(age) && !is_nan(height) && !is_inf(height)`},
+			want: "SAFE_DIVIDE(`age`, 0) > IEEE_DIVIDE(`height`, 0) AND DIV(`age`, 10) = 2 AND SAFE_ADD(`age`, 1) > SAFE_NEGATE(`age`) AND NOT IS_NAN(`height`) AND NOT IS_INF(`height`)",
+		},
+		{
+			name: "math_greatest_least",
+			args: args{source: `greatest(height, 1.5) > least(height, 1.8, 2.0) && least(age, 18, 20, 65, 80, 100) > 0 && greatest(name, "a", "b", "c") != "" && greatest(scores) < 1.0`},
+			want: "GREATEST(`height`, 1.5) > LEAST(`height`, 1.8, 2) AND LEAST(`age`, 18, 20, 65, 80, 100) > 0 AND GREATEST(`name`, \"a\", \"b\", \"c\") != \"\" AND (SELECT MAX(v) FROM UNNEST(`scores`) AS v) < 1",
+		},
+		{
+			name: "ext_math_greatest_least",
+			args: args{source: `math.greatest(height, 1.5) > math.least(height, 1.8, 2.0) && math.greatest(scores) >= 0.75 && math.least([height]) < 2.0 && math.greatest(age) > 0`},
+			want: "GREATEST(`height`, 1.5) > LEAST(`height`, 1.8, 2) AND (SELECT MAX(v) FROM UNNEST(`scores`) AS v) >= 0.75 AND `height` < 2 AND `age` > 0",
+		},
+		{
+			name: "array_functions",
+			args: args{source: `array_to_string(array_reverse(string_list), "/") == "a/b" && array_last(string_list) == "c" && array_first(array_concat(string_list, ["x"])) != "" && size(array_slice(string_list, 1, -1)) > 0`},
+			want: "ARRAY_TO_STRING(ARRAY_REVERSE(`string_list`), \"/\") = \"a/b\" AND ARRAY_LAST(`string_list`) = \"c\" AND ARRAY_FIRST(ARRAY_CONCAT(`string_list`, [\"x\"])) != \"\" AND ARRAY_LENGTH(ARRAY_SLICE(`string_list`, 1, -1)) > 0",
+		},
+		{
+			name: "generate_array",
+			args: args{source: `age in generate_array(18, 65, 1) && height in generate_array(1.0, 2.0, 0.1) && age in lists.range(10) && age in lists.range(age + 1)`},
+			want: "`age` IN UNNEST(GENERATE_ARRAY(18, 65, 1)) AND `height` IN UNNEST(GENERATE_ARRAY(1, 2, 0.1)) AND `age` IN UNNEST(GENERATE_ARRAY(0, 9)) AND `age` IN UNNEST(GENERATE_ARRAY(0, `age` + 1 - 1))",
+		},
+		{
+			name: "list_distinct",
+			args: args{source: `size(string_list.distinct()) == size(string_list)`},
+			want: "ARRAY_LENGTH(ARRAY(SELECT _v FROM UNNEST(`string_list`) AS _v WITH OFFSET AS _i GROUP BY _v ORDER BY MIN(_i))) = ARRAY_LENGTH(`string_list`)",
+		},
+		{
+			name: "list_flatten",
+			args: args{source: `"a" in [string_list, ["b", "c"]].flatten()`},
+			want: "\"a\" IN UNNEST(ARRAY_CONCAT(`string_list`, [\"b\", \"c\"]))",
+		},
+		{
+			name:    "list_flatten_variable",
+			args:    args{source: `"a" in [string_list].map(l, l).flatten()`},
+			wantErr: true,
+		},
+		{
+			name: "list_slice",
+			args: args{source: `"a" in string_list.slice(1, size(string_list) - 1)`},
+			want: "\"a\" IN UNNEST(ARRAY(SELECT _v FROM UNNEST(`string_list`) AS _v WITH OFFSET AS _i WHERE _i >= 1 AND _i < ARRAY_LENGTH(`string_list`) - 1 ORDER BY _i))",
+		},
+		{
+			name: "hash_functions",
+			args: args{source: `sha256(bytes(name)) == b"\x01\xff" && md5(name) != sha1(b"abc") && to_hex(sha512(name)) == "ab"`},
+			want: "SHA256(CAST(`name` AS BYTES)) = b\"\\001\\377\" AND MD5(`name`) != SHA1(b\"\\141\\142\\143\") AND TO_HEX(SHA512(`name`)) = \"ab\"",
+		},
+		{
+			name: "farm_fingerprint_sampling",
+			args: args{source: `mod(abs(farm_fingerprint(name)), 100) < 5`},
+			want: "MOD(ABS(FARM_FINGERPRINT(`name`)), 100) < 5",
+		},
+		{
+			name: "net_domain_functions",
+			args: args{source: `net.host(name) == "example.com" || net.reg_domain(name) in ["example.com", "example.org"] || net.public_suffix(name) == "co.jp"`},
+			want: "NET.HOST(`name`) = \"example.com\" OR NET.REG_DOMAIN(`name`) IN UNNEST([\"example.com\", \"example.org\"]) OR NET.PUBLIC_SUFFIX(`name`) = \"co.jp\"",
+		},
+		{
+			name: "net_ip_functions",
+			args: args{source: `net.ip_trunc(net.safe_ip_from_string(name), 24) == net.ip_from_string("10.0.0.0") && net.ip_to_string(net.ip_net_mask(4, 24)) != "" && net.ipv4_to_int64(net.ipv4_from_int64(age)) > 0`},
+			want: "NET.IP_TRUNC(NET.SAFE_IP_FROM_STRING(`name`), 24) = NET.IP_FROM_STRING(\"10.0.0.0\") AND NET.IP_TO_STRING(NET.IP_NET_MASK(4, 24)) != \"\" AND NET.IPV4_TO_INT64(NET.IPV4_FROM_INT64(`age`)) > 0",
+		},
+		{
+			name: "chained_conditional",
+			args: args{source: `age < 13 ? "child" : age < 20 ? "teen" : "adult"`},
+			want: "CASE WHEN `age` < 13 THEN \"child\" WHEN `age` < 20 THEN \"teen\" ELSE \"adult\" END",
+		},
+		{
+			name: "case_macro",
+			args: args{source: `case(age < 13, 0.5, age >= 65, 0.7, 1.0) * height > 1.0`},
+			want: "(CASE WHEN `age` < 13 THEN 0.5 WHEN `age` >= 65 THEN 0.7 ELSE 1 END) * `height` > 1",
+		},
+		{
+			name:           "case_macro_without_default",
+			args:           args{source: `case(age < 13, 0.5)`},
+			wantCompileErr: true,
+		},
+		{
+			name: "coalesce",
+			args: args{source: `coalesce(nullable_string, name, "unknown") == "a" && ifnull(nullable_string, "") != "" && nullif(age, 0) > 1`},
+			want: "COALESCE(`nullable_string`, `name`, \"unknown\") = \"a\" AND IFNULL(`nullable_string`, \"\") != \"\" AND NULLIF(`age`, 0) > 1",
+		},
+		{
+			name: "coalesce_many",
+			args: args{source: `coalesce(nullable_string, name, "a", "b", "c", "d") != "" && coalesce(string_list)[0] == "a"`},
+			want: "COALESCE(`nullable_string`, `name`, \"a\", \"b\", \"c\", \"d\") != \"\" AND COALESCE(`string_list`)[OFFSET(0)] = \"a\"",
+		},
+		{
+			name: "ext_strings_indexes",
+			args: args{source: `name.charAt(0) == "a" && name.indexOf("b") > 2 && name.indexOf("c", age) >= 0 && name.lastIndexOf("d") == name.lastIndexOf("d", age - 1)`},
+			want: "SUBSTR(`name`, 1, 1) = \"a\" AND STRPOS(`name`, \"b\") - 1 > 2 AND INSTR(`name`, \"c\", `age` + 1) - 1 >= 0 AND INSTR(`name`, \"d\", -1) - 1 = INSTR(`name`, \"d\", `age` - 1 - LENGTH(`name`)) - 1",
+		},
+		{
+			name: "ext_strings_substring",
+			args: args{source: `name.substring(1) == "bc" && name.substring(1, 3) == "bc" && name.substring(age, age + 2) == "bc"`},
+			want: "SUBSTR(`name`, 2) = \"bc\" AND SUBSTR(`name`, 2, 2) = \"bc\" AND SUBSTR(`name`, `age` + 1, `age` + 2 - `age`) = \"bc\"",
+		},
+		{
+			name: "ext_strings_case_trim",
+			args: args{source: `name.lowerAscii() == name.upperAscii().trim()`},
+			want: "LOWER(`name`) = TRIM(UPPER(`name`))",
+		},
+		{
+			name: "ext_strings_replace_limit",
+			args: args{source: `name.replace("a", "b", -1) == name.replace("a", "b", 0) && name.replace("a", "b", 2) == name.replace("a", "b", age) && replace(name, "a", "b") != ""`},
+			want: "REPLACE(`name`, \"a\", \"b\") = `name` AND IFNULL((SELECT STRING_AGG(IF(_i = 0, _v, IF(_i <= 2, \"b\", \"a\") || _v), \"\" ORDER BY _i) FROM UNNEST(SPLIT(`name`, \"a\")) AS _v WITH OFFSET AS _i), `name`) = IFNULL((SELECT STRING_AGG(IF(_i = 0, _v, IF(`age` < 0 OR _i <= `age`, \"b\", \"a\") || _v), \"\" ORDER BY _i) FROM UNNEST(SPLIT(`name`, \"a\")) AS _v WITH OFFSET AS _i), `name`) AND REPLACE(`name`, \"a\", \"b\") != \"\"",
+		},
+		{
+			name: "ext_strings_replace_limit_empty",
+			args: args{source: `"".replace("a", "b", 1) == ""`},
+			want: "IFNULL((SELECT STRING_AGG(IF(_i = 0, _v, IF(_i <= 1, \"b\", \"a\") || _v), \"\" ORDER BY _i) FROM UNNEST(SPLIT(\"\", \"a\")) AS _v WITH OFFSET AS _i), \"\") = \"\"",
+		},
+		{
+			name: "ext_strings_split_join",
+			args: args{source: `name.split("/").join("-") == name.split("/", -1).join() && "a" in name.split("/", 0) && "a" in name.split("/", 1) && "a" in name.split("/", 3)`},
+			want: "ARRAY_TO_STRING(SPLIT(`name`, \"/\"), \"-\") = ARRAY_TO_STRING(SPLIT(`name`, \"/\"), \"\") AND \"a\" IN UNNEST([]) AND \"a\" IN UNNEST([`name`]) AND \"a\" IN UNNEST(ARRAY(SELECT STRING_AGG(_v, \"/\" ORDER BY _i) FROM UNNEST(SPLIT(`name`, \"/\")) AS _v WITH OFFSET AS _i GROUP BY LEAST(_i, 2) ORDER BY MIN(_i)))",
+		},
+		{
+			name:    "ext_strings_split_variable_limit",
+			args:    args{source: `"a" in name.split("/", age)`},
+			wantErr: true,
+		},
+		{
+			name:   "optional_select_index",
+			args:   args{source: `trigram.?cell[?0].?page_count.orValue(0) > 1`},
+			want:   "IFNULL(`trigram`.`cell`[SAFE_OFFSET(0)].`page_count`, 0) > 1",
+			idents: []string{"trigram.cell", ".page_count"},
+		},
+		{
+			name:   "optional_or",
+			args:   args{source: `page.?title.or(page.?language).orValue("unknown") == "en"`},
+			want:   "COALESCE(`page`.`title`, `page`.`language`, \"unknown\") = \"en\"",
+			idents: []string{"page.title", "page.language"},
+		},
+		{
+			name: "optional_has_value",
+			args: args{source: `page.?title.hasValue() && page.?title.value() != "" && !trigram.?cell[?0].hasValue()`},
+			want: "`page`.`title` IS NOT NULL AND `page`.`title` != \"\" AND NOT `trigram`.`cell`[SAFE_OFFSET(0)] IS NOT NULL",
+		},
+		{
+			name: "optional_map_index",
+			args: args{source: `string_int_map[?"a"].orValue(0) + string_list[?1].orValue("").size() > 0`},
+			want: "IFNULL(`string_int_map`.`a`, 0) + LENGTH(IFNULL(`string_list`[SAFE_OFFSET(1)], \"\")) > 0",
+		},
+		{
+			name: "optional_constructors",
+			args: args{source: `optional.of(name).orValue("a") == optional.none().orValue("b") && optional.ofNonZeroValue(name).orValue("anonymous") != ""`},
+			want: "IFNULL(`name`, \"a\") = IFNULL(NULL, \"b\") AND IFNULL(NULLIF(`name`, \"\"), \"anonymous\") != \"\"",
 		},
 		{
 			name: "date_getFullYear",
@@ -375,22 +965,22 @@ func TestConvert(t *testing.T) {
 		{
 			name: "date_trunc",
 			args: args{source: `date("2023-01-01").trunc(DAY)`},
-			want: `DATE_TRUNC(DATE("2023-01-01"), DAY)`,
+			want: `DATE_TRUNC(DATE "2023-01-01", DAY)`,
 		},
 		{
 			name: "time_trunc",
 			args: args{source: `time("18:00:00").trunc(HOUR)`},
-			want: `TIME_TRUNC(TIME("18:00:00"), HOUR)`,
+			want: `TIME_TRUNC(TIME "18:00:00", HOUR)`,
 		},
 		{
 			name: "datetime_trunc",
 			args: args{source: `datetime("2023-09-01 18:00:00").trunc(MINUTE)`},
-			want: `DATETIME_TRUNC(DATETIME("2023-09-01 18:00:00"), MINUTE)`,
+			want: `DATETIME_TRUNC(DATETIME "2023-09-01 18:00:00", MINUTE)`,
 		},
 		{
 			name: "timestamp_trunc",
 			args: args{source: `timestamp("2023-09-01 18:00:00").trunc(WEEK)`},
-			want: `TIMESTAMP_TRUNC(TIMESTAMP("2023-09-01 18:00:00"), WEEK)`,
+			want: `TIMESTAMP_TRUNC(TIMESTAMP "2023-09-01 18:00:00+00:00", WEEK)`,
 		},
 		{
 			name:   "fieldSelect",
@@ -501,6 +1091,12 @@ func TestConvert(t *testing.T) {
 			want:   "EXISTS (SELECT * FROM UNNEST([\"foo\", \"bar\"]) AS x WHERE `x` = \"foo\")",
 			idents: []string{},
 		},
+		{
+			name:   "inplace_array_all",
+			args:   args{source: `["foo", "bar"].all(x, x != "" && x.size() < 4)`},
+			want:   "NOT EXISTS (SELECT * FROM UNNEST([\"foo\", \"bar\"]) AS x WHERE NOT (`x` != \"\" AND LENGTH(`x`) < 4))",
+			idents: []string{},
+		},
 		{
 			name: "filters_exists_equals",
 			args: args{source: `"foo".existsEquals("bar") && "foo".existsEquals(["bar"]) && ["foo"].existsEquals("bar") && ["foo"].existsEquals(["bar"])`},
@@ -665,7 +1261,7 @@ func TestConvert(t *testing.T) {
 				options = append(options, tt.options...)
 				got, err := cel2sql.Convert(ast, options...)
 				for _, v := range tracker.Values {
-					got = strings.ReplaceAll(got, "@"+v.Name, cel2sql.ValueToString(v.Value))
+					got = strings.ReplaceAll(got, "@"+v.Name, parameterToString(v.Value))
 				}
 				if !tt.wantErr && assert.NoError(t, err) {
 					assert.Equal(t, tt.want, got)
@@ -677,6 +1273,606 @@ func TestConvert(t *testing.T) {
 	}
 }
 
+// parameterToString writes the lists and typed NULLs of BigQueryNamedTracker back into literals.
+func parameterToString(val interface{}) string {
+	if param, ok := val.(*bigquery.QueryParameterValue); ok {
+		if param.Type.ArrayElementType != nil {
+			return "[]"
+		}
+		return "NULL"
+	}
+	if v := reflect.ValueOf(val); v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		elems := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elems = append(elems, cel2sql.ValueToString(v.Index(i).Interface()))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	}
+	return cel2sql.ValueToString(val)
+}
+
+func TestConvertTemporalParameters(t *testing.T) {
+	env, err := cel.NewEnv(
+		sqltypes.SQLTypeDeclarations,
+		cel.Declarations(
+			decls.NewVar("created_at", decls.Timestamp),
+			decls.NewVar("birthday", sqltypes.Date),
+			decls.NewVar("scheduled_at", sqltypes.DateTime),
+			decls.NewVar("fixed_time", sqltypes.Time),
+		),
+	)
+	require.NoError(t, err)
+	ast, issues := env.Compile(`created_at > timestamp("2023-01-01T00:00:00Z") && birthday > date("2000-01-01") && ` +
+		`scheduled_at > datetime("2023-01-01 12:00:00") && fixed_time > time("12:00:00")`)
+	require.Empty(t, issues)
+
+	tracker := bq.NewBigQueryNamedTracker()
+	got, err := cel2sql.Convert(ast, cel2sql.WithValueTracker(tracker))
+	require.NoError(t, err)
+	assert.Equal(t, "`created_at` > @v0t AND `birthday` > @v1t AND `scheduled_at` > @v2t AND `fixed_time` > @v3t", got)
+	values := make([]interface{}, 0, len(tracker.Values))
+	for _, v := range tracker.Values {
+		values = append(values, v.Value)
+	}
+	assert.Equal(t, []interface{}{
+		time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		civil.Date{Year: 2000, Month: 1, Day: 1},
+		civil.DateTime{Date: civil.Date{Year: 2023, Month: 1, Day: 1}, Time: civil.Time{Hour: 12}},
+		civil.Time{Hour: 12},
+	}, values)
+}
+
+func TestConvertTypedParameters(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.OptionalTypes(),
+		sqltypes.SQLTypeDeclarations,
+		cel.Declarations(
+			decls.NewVar("name", decls.String),
+			decls.NewVar("birthday", sqltypes.Date),
+		),
+	)
+	require.NoError(t, err)
+	ast, issues := env.Compile(`!(name in []) && !(birthday in []) && optional.none().orValue(name) == "a"`)
+	require.Empty(t, issues)
+
+	tracker := bq.NewBigQueryNamedTracker()
+	got, err := cel2sql.Convert(ast, cel2sql.WithValueTracker(tracker))
+	require.NoError(t, err)
+	assert.Equal(t, "NOT (`name` IN UNNEST(@v0t)) AND NOT (`birthday` IN UNNEST(@v1t)) AND IFNULL(@v2t, `name`) = @v3t", got)
+	values := make([]interface{}, 0, len(tracker.Values))
+	for _, v := range tracker.Values {
+		values = append(values, v.Value)
+	}
+	assert.Equal(t, []interface{}{
+		&bigquery.QueryParameterValue{
+			Type:  bigquery.StandardSQLDataType{TypeKind: "ARRAY", ArrayElementType: &bigquery.StandardSQLDataType{TypeKind: "STRING"}},
+			Value: []interface{}{},
+		},
+		&bigquery.QueryParameterValue{
+			Type:  bigquery.StandardSQLDataType{TypeKind: "ARRAY", ArrayElementType: &bigquery.StandardSQLDataType{TypeKind: "DATE"}},
+			Value: []interface{}{},
+		},
+		&bigquery.QueryParameterValue{
+			Type:  bigquery.StandardSQLDataType{TypeKind: "STRING"},
+			Value: bigquery.NullString{},
+		},
+		"a",
+	}, values)
+}
+
+func TestConvertListParameters(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.Declarations(
+			decls.NewVar("name", decls.String),
+			decls.NewVar("age", decls.Int),
+			decls.NewVar("nullable_string", decls.NewWrapperType(decls.String)),
+		),
+		filters.Declarations,
+	)
+	require.NoError(t, err)
+	ast, issues := env.Compile(`name in ["a", "b"] && name.existsEquals(["a", "b"]) && age in [1, 2, 3] && ` +
+		`nullable_string in ["a", null] && age in [1, age]`)
+	require.Empty(t, issues)
+
+	tracker := bq.NewBigQueryNamedTracker()
+	got, err := cel2sql.Convert(ast, cel2sql.WithValueTracker(tracker), cel2sql.WithExtension(filters.NewExtension()))
+	require.NoError(t, err)
+	assert.Equal(t, "`name` IN UNNEST(@v0t) AND `name` IN UNNEST(@v0t) AND `age` IN UNNEST(@v1t) AND "+
+		"`nullable_string` IN UNNEST([@v2t, NULL]) AND `age` IN UNNEST([@v3t, `age`])", got)
+	assert.Equal(t, []bigquery.QueryParameter{
+		{Name: "v0t", Value: []string{"a", "b"}},
+		{Name: "v1t", Value: []int64{1, 2, 3}},
+		{Name: "v2t", Value: "a"},
+		{Name: "v3t", Value: int64(1)},
+	}, tracker.Values)
+}
+
+func TestValueKey(t *testing.T) {
+	assert.Equal(t, cel2sql.ValueKey("a"), cel2sql.ValueKey("a"))
+	assert.Equal(t, cel2sql.ValueKey([]byte("a")), cel2sql.ValueKey([]byte("a")))
+	assert.Equal(t, cel2sql.ValueKey([]string{"a"}), cel2sql.ValueKey([]string{"a"}))
+	assert.NotEqual(t, cel2sql.ValueKey([]byte("a")), cel2sql.ValueKey([]byte("b")))
+	assert.NotEqual(t, cel2sql.ValueKey([]byte("a")), cel2sql.ValueKey("a"))
+	// a string which looks like the representation of another value
+	assert.NotEqual(t, cel2sql.ValueKey([]byte("a")), cel2sql.ValueKey(`[]uint8:[]byte{0x61}`))
+
+	tracker := bq.NewBigQueryNamedTracker()
+	assert.Equal(t, "@v0t", tracker.AddValue([]interface{}{"a", "b"}))
+	assert.Equal(t, "@v1t", tracker.AddValue(`[]string:[]string{"a", "b"}`))
+	assert.Equal(t, "@v0t", tracker.AddValue([]interface{}{"a", "b"}))
+}
+
+// TestConvertStringsExtensionV2 declares the functions added to ext.Strings() after the cel-go version in go.mod.
+func TestConvertStringsExtensionV2(t *testing.T) {
+	env, err := cel.NewEnv(
+		ext.Strings(),
+		cel.Declarations(
+			decls.NewVar("name", decls.String),
+			decls.NewVar("age", decls.Int),
+			decls.NewVar("height", decls.Double),
+			decls.NewFunction("format",
+				decls.NewInstanceOverload("string_format", []*cel2sql.Type{decls.String, decls.NewListType(decls.Dyn)}, decls.String),
+			),
+			decls.NewFunction("strings.quote",
+				decls.NewOverload("strings_quote", []*cel2sql.Type{decls.String}, decls.String),
+			),
+			decls.NewFunction("reverse",
+				decls.NewInstanceOverload("string_reverse", []*cel2sql.Type{decls.String}, decls.String),
+			),
+		),
+	)
+	require.NoError(t, err)
+	tests := []struct {
+		name    string
+		source  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "format",
+			source: `"%s is %d years old, %.2f m, 100%%".format([name, age, height]) == "%s".format([age])`,
+			want:   "FORMAT(\"%s is %d years old, %.2f m, 100%%\", `name`, `age`, `height`) = FORMAT(\"%t\", `age`)",
+		},
+		{
+			name:    "format_binary",
+			source:  `"%b".format([age]) == ""`,
+			wantErr: true,
+		},
+		{
+			name:    "format_arguments",
+			source:  `"%s %s".format([name]) == ""`,
+			wantErr: true,
+		},
+		{
+			name:   "quote",
+			source: `strings.quote(name) == "\"a\""`,
+			want:   "FORMAT(\"%T\", `name`) = \"\\\"a\\\"\"",
+		},
+		{
+			name:   "reverse",
+			source: `name.reverse() == "cba"`,
+			want:   "REVERSE(`name`) = \"cba\"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ast, issues := env.Compile(tt.source)
+			require.Empty(t, issues)
+			got, err := cel2sql.Convert(ast)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestConvertKeepsEvaluableAST(t *testing.T) {
+	env, err := cel.NewEnv(
+		sqltypes.AdditionalMacros,
+		sqltypes.SQLTypeDeclarations,
+		cel.Declarations(
+			decls.NewVar("name", decls.String),
+			decls.NewVar("created_at", decls.Timestamp),
+		),
+	)
+	require.NoError(t, err)
+	ast, issues := env.Compile(`name == "a" && name != "b" && created_at == timestamp("2024-01-01T00:00:00Z") && name != "2024-01-01"`)
+	require.Empty(t, issues)
+
+	got, err := cel2sql.Convert(ast)
+	require.NoError(t, err)
+	assert.Equal(t, "`name` = \"a\" AND `name` != \"b\" AND `created_at` = TIMESTAMP \"2024-01-01 00:00:00+00:00\" AND `name` != \"2024-01-01\"", got)
+
+	prg, err := env.Program(ast)
+	require.NoError(t, err)
+	out, _, err := prg.Eval(map[string]interface{}{
+		"name":       "a",
+		"created_at": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, true, out.Value())
+}
+
+func TestConvertWarnings(t *testing.T) {
+	env, err := cel.NewEnv(
+		sqltypes.SQLTypeDeclarations,
+		cel.Declarations(
+			decls.NewVar("created_at", decls.Timestamp),
+			decls.NewVar("birthday", sqltypes.Date),
+			decls.NewVar("scheduled_at", sqltypes.DateTime),
+		),
+	)
+	require.NoError(t, err)
+	tests := []struct {
+		name    string
+		source  string
+		options []cel2sql.ConvertOption
+		want    []string
+	}{
+		{
+			name:   "string_literal",
+			source: `birthday <= "2024-01-01" && scheduled_at >= birthday`,
+			want:   nil,
+		},
+		{
+			name:   "date_timestamp",
+			source: `birthday >= timestamp("2024-01-01T00:00:00Z") && birthday < created_at`,
+			want: []string{
+				"comparing DATE with TIMESTAMP converts the TIMESTAMP to DATE in UTC",
+				"comparing DATE with TIMESTAMP interprets the DATE in UTC",
+			},
+		},
+		{
+			name:    "datetime_timestamp",
+			source:  `created_at > scheduled_at && birthday > datetime("2024-01-01 12:00:00")`,
+			options: []cel2sql.ConvertOption{cel2sql.WithTimeZone("Asia/Tokyo")},
+			want: []string{
+				"comparing DATETIME with TIMESTAMP interprets the DATETIME in Asia/Tokyo",
+				"comparing DATE with DATETIME truncates the DATETIME",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ast, issues := env.Compile(tt.source)
+			require.Empty(t, issues)
+			var tracker warningTracker
+			_, err := cel2sql.Convert(ast, append(tt.options, cel2sql.WithWarningTracker(&tracker))...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, []string(tracker))
+		})
+	}
+}
+
+func TestConvertIdentifiers(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.CustomTypeProvider(bq.NewTypeProvider(map[string]bigquery.Schema{
+			"wikipedia": test.NewWikipediaTableMetadata().Schema,
+		})),
+		cel.Declarations(
+			decls.NewVar("page", decls.NewObjectType("wikipedia")),
+			decls.NewVar("string_int_map", decls.NewMapType(decls.String, decls.Int)),
+			decls.NewVar("json", decls.Dyn),
+		),
+	)
+	require.NoError(t, err)
+	tests := []struct {
+		name    string
+		source  string
+		options []cel2sql.ConvertOption
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "escape",
+			source:  `page.title == "a"`,
+			options: []cel2sql.ConvertOption{cel2sql.WithIdentTracker(renamingTracker{"page", "p`a\\ge\n"})},
+			want:    "`p\\`a\\\\ge\\n`.`title` = \"a\"",
+		},
+		{
+			name:    "empty",
+			source:  `page.title == "a"`,
+			options: []cel2sql.ConvertOption{cel2sql.WithIdentTracker(renamingTracker{"page", ""})},
+			wantErr: true,
+		},
+		{
+			name:    "strict_field",
+			source:  `page.title == "a"`,
+			options: []cel2sql.ConvertOption{cel2sql.WithStrictIdentifiers()},
+			want:    "`page`.`title` = \"a\"",
+		},
+		{
+			name:    "strict_map_select",
+			source:  `string_int_map.key == 1`,
+			options: []cel2sql.ConvertOption{cel2sql.WithStrictIdentifiers()},
+			wantErr: true,
+		},
+		{
+			name:    "strict_map_index",
+			source:  `string_int_map["key"] == 1`,
+			options: []cel2sql.ConvertOption{cel2sql.WithStrictIdentifiers()},
+			wantErr: true,
+		},
+		{
+			name:    "strict_dyn",
+			source:  `json.key == 1`,
+			options: []cel2sql.ConvertOption{cel2sql.WithStrictIdentifiers()},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ast, issues := env.Compile(tt.source)
+			require.Empty(t, issues)
+			got, err := cel2sql.Convert(ast, tt.options...)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConvertFieldMapping(t *testing.T) {
+	schemas := map[string]bigquery.Schema{
+		"Event": {
+			{Name: "url", Type: bigquery.StringFieldType},
+			{Name: "display_name", Type: bigquery.StringFieldType},
+			{Name: "location", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+				{Name: "city", Type: bigquery.StringFieldType},
+			}},
+			{Name: "tags", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+				{Name: "name", Type: bigquery.StringFieldType},
+			}},
+		},
+	}
+	mapping := cel2sql.FieldMapping{
+		"Event": {
+			"domain": {SQL: "NET.REG_DOMAIN(`url`)", Type: decls.String},
+			"name":   {SQL: "`e`.`display_name`", Type: decls.String},
+			"place":  {SQL: "`e`.`location`", Type: decls.NewObjectType("Event.location")},
+		},
+		"Event.tags": {
+			"label": {SQL: "`name`", Type: decls.String},
+		},
+	}
+	env, err := cel.NewEnv(
+		cel.EnableMacroCallTracking(),
+		cel.CustomTypeProvider(bq.NewTypeProvider(schemas, bq.WithFieldMapping(mapping))),
+		cel.Declarations(
+			decls.NewVar("event", decls.NewObjectType("Event")),
+		),
+	)
+	require.NoError(t, err)
+	tests := []struct {
+		name    string
+		source  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "virtual",
+			source: `event.domain == "example.com"`,
+			want:   "(NET.REG_DOMAIN(`url`)) = \"example.com\"",
+		},
+		{
+			name:   "column",
+			source: `event.name == "a" && event.url == "b"`,
+			want:   "(`e`.`display_name`) = \"a\" AND `event`.`url` = \"b\"",
+		},
+		{
+			name:   "nested",
+			source: `event.place.city == "Tokyo"`,
+			want:   "(`e`.`location`).`city` = \"Tokyo\"",
+		},
+		{
+			name:   "has",
+			source: `has(event.domain)`,
+			want:   "(NET.REG_DOMAIN(`url`)) IS NOT NULL",
+		},
+		{
+			name:    "comprehension",
+			source:  `event.tags.exists(t, t.label == "a")`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ast, issues := env.Compile(tt.source)
+			require.Empty(t, issues)
+			got, err := cel2sql.Convert(ast, cel2sql.WithFieldMapping(mapping))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConvertTableAliases(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.EnableMacroCallTracking(),
+		cel.CustomTypeProvider(bq.NewTypeProvider(map[string]bigquery.Schema{
+			"wikipedia": test.NewWikipediaTableMetadata().Schema,
+		})),
+		cel.Declarations(
+			decls.NewVar("page", decls.NewObjectType("wikipedia")),
+			decls.NewVar("name", decls.String),
+			decls.NewVar("string_list", decls.NewListType(decls.String)),
+		),
+	)
+	require.NoError(t, err)
+	ast, issues := env.Compile(`page.title == "a" && name == "b" && string_list.exists(s, s == "c")`)
+	require.Empty(t, issues)
+
+	tests := []struct {
+		name    string
+		options []cel2sql.ConvertOption
+		want    string
+	}{
+		{
+			name:    "variable",
+			options: []cel2sql.ConvertOption{cel2sql.WithTableAlias("page", "p")},
+			want:    "`p`.`title` = \"a\" AND `name` = \"b\" AND EXISTS (SELECT * FROM UNNEST(`string_list`) AS s WHERE `s` = \"c\")",
+		},
+		{
+			name:    "default",
+			options: []cel2sql.ConvertOption{cel2sql.WithTableAlias("page", "p"), cel2sql.WithDefaultTableAlias("t")},
+			want:    "`p`.`title` = \"a\" AND `t`.`name` = \"b\" AND EXISTS (SELECT * FROM UNNEST(`t`.`string_list`) AS s WHERE `s` = \"c\")",
+		},
+		{
+			// the alias is looked up by the variable in CEL, not by the renamed one
+			name: "renamed_variable",
+			options: []cel2sql.ConvertOption{
+				cel2sql.WithTableAlias("page", "p"), cel2sql.WithDefaultTableAlias("t"),
+				cel2sql.WithIdentTracker(renamingTracker{"page", "pages"}),
+			},
+			want: "`p`.`title` = \"a\" AND `t`.`name` = \"b\" AND EXISTS (SELECT * FROM UNNEST(`t`.`string_list`) AS s WHERE `s` = \"c\")",
+		},
+		{
+			name: "renamed_default",
+			options: []cel2sql.ConvertOption{
+				cel2sql.WithTableAlias("page", "p"), cel2sql.WithDefaultTableAlias("t"),
+				cel2sql.WithIdentTracker(renamingTracker{"name", "full_name"}),
+			},
+			want: "`p`.`title` = \"a\" AND `t`.`full_name` = \"b\" AND EXISTS (SELECT * FROM UNNEST(`t`.`string_list`) AS s WHERE `s` = \"c\")",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cel2sql.Convert(ast, tt.options...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestConvertRelationships(t *testing.T) {
+	schemas := map[string]bigquery.Schema{
+		"Employee": {
+			{Name: "id", Type: bigquery.IntegerFieldType},
+			{Name: "name", Type: bigquery.StringFieldType},
+			{Name: "manager_id", Type: bigquery.IntegerFieldType},
+		},
+		"Device": {
+			{Name: "employee_id", Type: bigquery.IntegerFieldType},
+			{Name: "os", Type: bigquery.StringFieldType},
+		},
+	}
+	relationships := cel2sql.Relationships{
+		"Employee": {
+			"manager": {Table: "`employees`", Type: "Employee", LocalKey: "manager_id", ForeignKey: "id"},
+			"devices": {Table: "`devices`", Type: "Device", LocalKey: "id", ForeignKey: "employee_id", Many: true},
+		},
+	}
+	mapping := cel2sql.FieldMapping{
+		"Employee": {
+			"display": {SQL: "UPPER(`name`)", Type: decls.String, Columns: []string{"name"}},
+		},
+	}
+	env, err := cel.NewEnv(
+		cel.EnableMacroCallTracking(),
+		cel.CustomTypeProvider(bq.NewTypeProvider(schemas, bq.WithRelationships(relationships), bq.WithFieldMapping(mapping))),
+		cel.Declarations(
+			decls.NewVar("employee", decls.NewObjectType("Employee")),
+		),
+	)
+	require.NoError(t, err)
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "many_to_one",
+			source: `employee.manager.name == "x"`,
+			want:   "(SELECT _r0.`name` FROM `employees` AS _r0 WHERE _r0.`id` = `employee`.`manager_id`) = \"x\"",
+		},
+		{
+			name:   "nested",
+			source: `employee.manager.manager.name == "x"`,
+			want: "(SELECT (SELECT _r1.`name` FROM `employees` AS _r1 WHERE _r1.`id` = _r0.`manager_id`) " +
+				"FROM `employees` AS _r0 WHERE _r0.`id` = `employee`.`manager_id`) = \"x\"",
+		},
+		{
+			name:   "mapped_field",
+			source: `employee.manager.display == "x"`,
+			want:   "(SELECT (UPPER(`name`)) FROM `employees` AS _r0 WHERE _r0.`id` = `employee`.`manager_id`) = \"x\"",
+		},
+		{
+			name:   "nested_mapped_field",
+			source: `employee.manager.manager.display == "x"`,
+			want: "(SELECT (SELECT (UPPER(`name`)) FROM `employees` AS _r1 WHERE _r1.`id` = _r0.`manager_id`) " +
+				"FROM `employees` AS _r0 WHERE _r0.`id` = `employee`.`manager_id`) = \"x\"",
+		},
+		{
+			name:   "has",
+			source: `has(employee.manager)`,
+			want:   "(SELECT AS STRUCT _r0.* FROM `employees` AS _r0 WHERE _r0.`id` = `employee`.`manager_id`) IS NOT NULL",
+		},
+		{
+			name:   "exists",
+			source: `employee.devices.exists(d, d.os == "mac" || d.os == "ios")`,
+			want:   "EXISTS (SELECT * FROM `devices` AS d WHERE d.`employee_id` = `employee`.`id` AND (`d`.`os` = \"mac\" OR `d`.`os` = \"ios\"))",
+		},
+		{
+			name:   "exists_across_many_to_one",
+			source: `employee.manager.devices.exists(d, d.os == "mac")`,
+			want: "EXISTS (SELECT * FROM `devices` AS d WHERE d.`employee_id` = " +
+				"(SELECT _r0.`id` FROM `employees` AS _r0 WHERE _r0.`id` = `employee`.`manager_id`) AND `d`.`os` = \"mac\")",
+		},
+		{
+			name:   "filter",
+			source: `size(employee.devices.filter(d, d.os == "mac")) > 0`,
+			want:   "ARRAY_LENGTH(ARRAY(SELECT d FROM `devices` AS d WHERE d.`employee_id` = `employee`.`id` AND `d`.`os` = \"mac\")) > 0",
+		},
+		{
+			name:   "all",
+			source: `employee.devices.all(d, d.os == "mac")`,
+			want:   "NOT EXISTS (SELECT * FROM `devices` AS d WHERE d.`employee_id` = `employee`.`id` AND NOT (`d`.`os` = \"mac\"))",
+		},
+		{
+			name:   "one_to_many",
+			source: `size(employee.devices) > 0`,
+			want:   "ARRAY_LENGTH(ARRAY(SELECT AS STRUCT _r0.* FROM `devices` AS _r0 WHERE _r0.`employee_id` = `employee`.`id`)) > 0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ast, issues := env.Compile(tt.source)
+			require.Empty(t, issues)
+			got, err := cel2sql.Convert(ast, cel2sql.WithRelationships(relationships), cel2sql.WithFieldMapping(mapping))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// renamingTracker renames the root of paths from old to new.
+type renamingTracker [2]string
+
+func (t renamingTracker) AddIdentAccess(rootExpr *cel2sql.Expr, path []string) []string {
+	if rootExpr == nil && path[0] == t[0] {
+		return append([]string{t[1]}, path[1:]...)
+	}
+	return path
+}
+
+type warningTracker []string
+
+func (t *warningTracker) AddWarning(expr *cel2sql.Expr, message string) {
+	*t = append(*t, message)
+}
+
 type identTracker map[string]struct{}
 
 func (t identTracker) AddIdentAccess(rootExpr *cel2sql.Expr, path []string) (res []string) {
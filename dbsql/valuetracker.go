@@ -0,0 +1,183 @@
+// Package dbsql provides value trackers which turn the values of converted filters into query arguments of database/sql.
+// The trackers only bind parameters; the converted SQL is still in the BigQuery dialect, so only simple filters of
+// comparisons and logical operators run on SQLite and MySQL, and none on PostgreSQL and SQL Server,
+// which reject backtick-quoted identifiers.
+package dbsql
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/civil"
+
+	"github.com/cockscomb/cel2sql"
+)
+
+type Dialect int
+
+const (
+	MySQL Dialect = iota
+	SQLite
+	PostgreSQL
+	SQLServer
+)
+
+// Tracker collects values as positional arguments, written as ? for MySQL and SQLite,
+// $1, $2, ... for PostgreSQL, and @p1, @p2, ... for SQL Server.
+type Tracker struct {
+	Dialect Dialect
+	Values  []interface{}
+	indexes map[interface{}]int
+}
+
+func NewTracker(dialect Dialect) *Tracker {
+	return &Tracker{Dialect: dialect}
+}
+
+func NewMySQLTracker() *Tracker {
+	return NewTracker(MySQL)
+}
+
+func NewSQLiteTracker() *Tracker {
+	return NewTracker(SQLite)
+}
+
+func NewPostgreSQLTracker() *Tracker {
+	return NewTracker(PostgreSQL)
+}
+
+func NewSQLServerTracker() *Tracker {
+	return NewTracker(SQLServer)
+}
+
+func (t *Tracker) AddValue(val interface{}) string {
+	if val == nil {
+		// untyped NULL parameters are rejected by some drivers
+		return "NULL"
+	}
+	val = encode(t.Dialect, val)
+	switch t.Dialect {
+	case PostgreSQL, SQLServer:
+		// numbered placeholders can refer to the same value more than once
+		if t.indexes == nil {
+			t.indexes = make(map[interface{}]int)
+		}
+		key := cel2sql.ValueKey(val)
+		if i, ok := t.indexes[key]; ok {
+			return t.placeholder(i)
+		}
+		t.indexes[key] = len(t.Values)
+	}
+	t.Values = append(t.Values, val)
+	return t.placeholder(len(t.Values) - 1)
+}
+
+func (t *Tracker) placeholder(index int) string {
+	switch t.Dialect {
+	case PostgreSQL:
+		return "$" + strconv.Itoa(index+1)
+	case SQLServer:
+		return "@p" + strconv.Itoa(index+1)
+	default:
+		return "?"
+	}
+}
+
+// Args returns the values to be passed to db.QueryContext.
+func (t *Tracker) Args() []interface{} {
+	return t.Values
+}
+
+// NamedTracker collects values as sql.NamedArg, written as @v0, @v1, ...
+// Only the drivers of SQLite and SQL Server accept sql.NamedArg.
+type NamedTracker struct {
+	Dialect Dialect
+	Values  []sql.NamedArg
+	names   map[interface{}]string
+}
+
+// NewNamedTracker returns a NamedTracker for SQLite or SQL Server.
+// The drivers of MySQL and PostgreSQL reject sql.NamedArg, so use Tracker for them.
+func NewNamedTracker(dialect Dialect) (*NamedTracker, error) {
+	switch dialect {
+	case SQLite, SQLServer:
+		return &NamedTracker{Dialect: dialect}, nil
+	default:
+		return nil, fmt.Errorf("named arguments are not supported by the dialect %d", dialect)
+	}
+}
+
+func (t *NamedTracker) AddValue(val interface{}) string {
+	if val == nil {
+		return "NULL"
+	}
+	val = encode(t.Dialect, val)
+	if t.names == nil {
+		t.names = make(map[interface{}]string)
+	}
+	key := cel2sql.ValueKey(val)
+	if name, ok := t.names[key]; ok {
+		return "@" + name
+	}
+	name := fmt.Sprintf("v%d", len(t.Values))
+	t.Values = append(t.Values, sql.Named(name, val))
+	t.names[key] = name
+	return "@" + name
+}
+
+// Args returns the values to be passed to db.QueryContext.
+func (t *NamedTracker) Args() []interface{} {
+	args := make([]interface{}, 0, len(t.Values))
+	for _, v := range t.Values {
+		args = append(args, v)
+	}
+	return args
+}
+
+const (
+	dateTimeLayout = "2006-01-02 15:04:05.999999"
+	timeLayout     = "15:04:05.999999"
+)
+
+// encode converts val into a value the drivers of the dialect accept.
+func encode(dialect Dialect, val interface{}) interface{} {
+	switch v := val.(type) {
+	case uint64:
+		if v > math.MaxInt64 {
+			// database/sql rejects uint64 values with the high bit set
+			return strconv.FormatUint(v, 10)
+		}
+		return int64(v)
+	case bool:
+		if dialect == SQLite {
+			// SQLite has no boolean type and stores 0 and 1
+			if v {
+				return int64(1)
+			}
+			return int64(0)
+		}
+		return v
+	case time.Time:
+		switch dialect {
+		case SQLite:
+			// the date and time functions of SQLite read text in UTC
+			return v.UTC().Format(dateTimeLayout)
+		case MySQL:
+			// DATETIME and TIMESTAMP columns of MySQL hold no time zone
+			return v.UTC()
+		default:
+			return v
+		}
+	case civil.Date:
+		return v.String()
+	case civil.DateTime:
+		return v.In(time.UTC).Format(dateTimeLayout)
+	case civil.Time:
+		return time.Date(0, 1, 1, v.Hour, v.Minute, v.Second, v.Nanosecond, time.UTC).Format(timeLayout)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,123 @@
+package dbsql_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockscomb/cel2sql"
+	"github.com/cockscomb/cel2sql/dbsql"
+	"github.com/cockscomb/cel2sql/sqltypes"
+)
+
+func TestTracker(t *testing.T) {
+	env, err := cel.NewEnv(
+		sqltypes.SQLTypeDeclarations,
+		cel.Declarations(
+			decls.NewVar("name", decls.String),
+			decls.NewVar("nickname", decls.String),
+			decls.NewVar("avatar", decls.Bytes),
+			decls.NewVar("nullable_string", decls.NewWrapperType(decls.String)),
+			decls.NewVar("birthday", sqltypes.Date),
+			decls.NewVar("created_at", decls.Timestamp),
+		),
+	)
+	require.NoError(t, err)
+	ast, issues := env.Compile(`name == "a" && nickname == "a" && avatar == b"\x00" && ` +
+		`nullable_string != null && birthday > date("2000-01-01") && created_at > timestamp("2023-01-01T09:00:00+09:00")`)
+	require.Empty(t, issues)
+
+	createdAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		tracker  *dbsql.Tracker
+		want     string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "mysql",
+			tracker:  dbsql.NewMySQLTracker(),
+			want:     "`name` = ? AND `nickname` = ? AND `avatar` = ? AND `nullable_string` IS NOT NULL AND `birthday` > ? AND `created_at` > ?",
+			wantArgs: []interface{}{"a", "a", []byte{0}, "2000-01-01", createdAt},
+		},
+		{
+			name:     "sqlite",
+			tracker:  dbsql.NewSQLiteTracker(),
+			want:     "`name` = ? AND `nickname` = ? AND `avatar` = ? AND `nullable_string` IS NOT NULL AND `birthday` > ? AND `created_at` > ?",
+			wantArgs: []interface{}{"a", "a", []byte{0}, "2000-01-01", "2023-01-01 00:00:00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cel2sql.Convert(ast, cel2sql.WithValueTracker(tt.tracker))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantArgs, tt.tracker.Args())
+		})
+	}
+}
+
+func TestNamedTracker(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.Declarations(
+			decls.NewVar("name", decls.String),
+			decls.NewVar("nickname", decls.String),
+			decls.NewVar("age", decls.Int),
+		),
+	)
+	require.NoError(t, err)
+	ast, issues := env.Compile(`name == "a" && nickname == "a" && age > 20`)
+	require.Empty(t, issues)
+
+	tracker, err := dbsql.NewNamedTracker(dbsql.SQLite)
+	require.NoError(t, err)
+	got, err := cel2sql.Convert(ast, cel2sql.WithValueTracker(tracker))
+	require.NoError(t, err)
+	assert.Equal(t, "`name` = @v0 AND `nickname` = @v0 AND `age` > @v1", got)
+	assert.Equal(t, []interface{}{sql.Named("v0", "a"), sql.Named("v1", int64(20))}, tracker.Args())
+}
+
+func TestTracker_NumberedPlaceholders(t *testing.T) {
+	createdAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		tracker  *dbsql.Tracker
+		want     []string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "postgresql",
+			tracker:  dbsql.NewPostgreSQLTracker(),
+			want:     []string{"$1", "$1", "$2", "NULL", "$3"},
+			wantArgs: []interface{}{"a", true, createdAt},
+		},
+		{
+			name:     "sqlserver",
+			tracker:  dbsql.NewSQLServerTracker(),
+			want:     []string{"@p1", "@p1", "@p2", "NULL", "@p3"},
+			wantArgs: []interface{}{"a", true, createdAt},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, val := range []interface{}{"a", "a", true, nil, createdAt} {
+				got = append(got, tt.tracker.AddValue(val))
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantArgs, tt.tracker.Args())
+		})
+	}
+}
+
+func TestNewNamedTracker_UnsupportedDialect(t *testing.T) {
+	for _, dialect := range []dbsql.Dialect{dbsql.MySQL, dbsql.PostgreSQL} {
+		_, err := dbsql.NewNamedTracker(dialect)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,89 @@
+package cel2sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// calendarDuration is a duration which may contain calendar units.
+// Unlike clock units, years, months and days have no fixed length, so they are kept apart.
+type calendarDuration struct {
+	years  int64
+	months int64
+	days   int64
+	clock  time.Duration
+}
+
+func (d calendarDuration) isCalendar() bool {
+	return d.years != 0 || d.months != 0 || d.days != 0
+}
+
+// isSingleUnit reports whether d can be written as a single INTERVAL literal.
+func (d calendarDuration) isSingleUnit() bool {
+	n := 0
+	for _, nonZero := range []bool{d.years != 0, d.months != 0, d.days != 0, d.clock != 0} {
+		if nonZero {
+			n++
+		}
+	}
+	return n <= 1
+}
+
+var calendarUnits = map[string]func(d *calendarDuration, n int64){
+	"y":  func(d *calendarDuration, n int64) { d.years += n },
+	"mo": func(d *calendarDuration, n int64) { d.months += n },
+	"w":  func(d *calendarDuration, n int64) { d.days += 7 * n },
+	"d":  func(d *calendarDuration, n int64) { d.days += n },
+}
+
+// parseCalendarDuration parses durations like "1h30m", "7d", "1w" or "1y2mo".
+// In addition to the units accepted by time.ParseDuration, it accepts
+// "y" (years), "mo" (months), "w" (weeks) and "d" (days), which must have integer values.
+func parseCalendarDuration(s string) (calendarDuration, error) {
+	var d calendarDuration
+	orig := s
+	neg := false
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	if s == "0" {
+		return d, nil
+	}
+	if s == "" {
+		return d, fmt.Errorf("invalid duration %q", orig)
+	}
+	for s != "" {
+		i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+		if i <= 0 {
+			return d, fmt.Errorf("invalid duration %q", orig)
+		}
+		num := s[:i]
+		s = s[i:]
+		j := strings.IndexFunc(s, func(r rune) bool { return ('0' <= r && r <= '9') || r == '.' })
+		if j < 0 {
+			j = len(s)
+		}
+		unit := s[:j]
+		s = s[j:]
+		if add, ok := calendarUnits[unit]; ok {
+			n, err := strconv.ParseInt(num, 10, 64)
+			if err != nil {
+				return d, fmt.Errorf("invalid duration %q: unit %q requires an integer", orig, unit)
+			}
+			add(&d, n)
+			continue
+		}
+		c, err := time.ParseDuration(num + unit)
+		if err != nil {
+			return d, fmt.Errorf("invalid duration %q: unknown unit %q", orig, unit)
+		}
+		d.clock += c
+	}
+	if neg {
+		d.years, d.months, d.days, d.clock = -d.years, -d.months, -d.days, -d.clock
+	}
+	return d, nil
+}
@@ -3,7 +3,7 @@ module github.com/cockscomb/cel2sql
 go 1.16
 
 require (
-	cloud.google.com/go v0.110.0 // indirect
+	cloud.google.com/go v0.110.0
 	cloud.google.com/go/bigquery v1.47.0
 	cloud.google.com/go/iam v0.12.0 // indirect
 	github.com/andybalholm/brotli v1.0.5 // indirect
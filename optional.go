@@ -0,0 +1,97 @@
+package cel2sql
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/common/operators"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Optional values of cel.OptionalTypes() are represented by nullable SQL values, where NULL means none.
+// Field access and SAFE_OFFSET already propagate NULL, so a.?b.?c needs no guards.
+
+func isOptionalType(typ *exprpb.Type) bool {
+	return typ.GetAbstractType().GetName() == "optional"
+}
+
+// unwrapOptionalType returns the type of the value held by an optional type, or typ itself.
+func unwrapOptionalType(typ *exprpb.Type) *exprpb.Type {
+	if isOptionalType(typ) && len(typ.GetAbstractType().GetParameterTypes()) == 1 {
+		return typ.GetAbstractType().GetParameterTypes()[0]
+	}
+	return typ
+}
+
+// optionalSelect returns the operand and field of a.?b.
+func optionalSelect(expr *exprpb.Expr) (*exprpb.Expr, string, bool) {
+	c := expr.GetCallExpr()
+	if c == nil || c.GetFunction() != operators.OptSelect || len(c.GetArgs()) != 2 || !isStringLiteral(c.GetArgs()[1]) {
+		return nil, "", false
+	}
+	return c.GetArgs()[0], c.GetArgs()[1].GetConstExpr().GetStringValue(), true
+}
+
+// visitCallOptIndex converts list[?i] into SAFE_OFFSET, and map[?key] into field access.
+func (con *Converter) visitCallOptIndex(expr *exprpb.Expr) error {
+	args := expr.GetCallExpr().GetArgs()
+	if IsMapType(unwrapOptionalType(con.GetType(args[0]))) {
+		return con.visitCallMapIndex(expr)
+	}
+	return con.visitCallListGet(args[0], args[1:])
+}
+
+// callOptionalOr converts opt.or(other) and opt.orValue(value), flattening chains into a single COALESCE.
+func (con *Converter) callOptionalOr(fun string, target *exprpb.Expr, args []*exprpb.Expr) error {
+	operands := []*exprpb.Expr{args[0]}
+	for {
+		c := target.GetCallExpr()
+		if c == nil || c.GetFunction() != "or" || c.GetTarget() == nil || !isOptionalType(con.GetType(c.GetTarget())) {
+			break
+		}
+		operands = append(operands, c.GetArgs()[0])
+		target = c.GetTarget()
+	}
+	operands = append(operands, target)
+	if len(operands) == 2 && fun == "orValue" {
+		con.str.WriteString("IFNULL(")
+	} else {
+		con.str.WriteString("COALESCE(")
+	}
+	for i := len(operands) - 1; i >= 0; i-- {
+		if err := con.Visit(operands[i]); err != nil {
+			return err
+		}
+		if i > 0 {
+			con.str.WriteString(", ")
+		}
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+// callOptionalOfNonZeroValue converts optional.ofNonZeroValue(x) into NULLIF(x, zero).
+func (con *Converter) callOptionalOfNonZeroValue(arg *exprpb.Expr) error {
+	var zero interface{}
+	switch typ := con.GetType(arg); typ.GetPrimitive() {
+	case exprpb.Type_STRING:
+		zero = ""
+	case exprpb.Type_BYTES:
+		zero = []byte{}
+	case exprpb.Type_INT64, exprpb.Type_UINT64:
+		zero = int64(0)
+	case exprpb.Type_DOUBLE:
+		zero = float64(0)
+	case exprpb.Type_BOOL:
+		zero = false
+	default:
+		return fmt.Errorf("unsupported type for optional.ofNonZeroValue(): %v", typ)
+	}
+	con.str.WriteString("NULLIF(")
+	if err := con.Visit(arg); err != nil {
+		return err
+	}
+	con.str.WriteString(", ")
+	con.str.WriteString(ValueToString(zero))
+	con.str.WriteString(")")
+	return nil
+}
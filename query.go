@@ -0,0 +1,168 @@
+package cel2sql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+)
+
+type SortDirection int
+
+const (
+	Ascending SortDirection = iota
+	Descending
+)
+
+// Query builds a SELECT statement from CEL expressions.
+type Query struct {
+	table       string
+	alias       string
+	projections []projection
+	filter      *cel.Ast
+	sortKeys    []sortKey
+	limit       *int64
+	offset      *int64
+}
+
+type projection struct {
+	expr  *cel.Ast
+	alias string
+}
+
+type sortKey struct {
+	expr      *cel.Ast
+	direction SortDirection
+}
+
+// NewQuery creates a Query from table, which is quoted as an identifier like `project.dataset.table`,
+// or part by part like `schema`.`table` with SpannerSQL.
+func NewQuery(table string) *Query {
+	return &Query{table: table}
+}
+
+// As names the table with alias, which WithTableAlias or WithDefaultTableAlias can refer to.
+func (q *Query) As(alias string) *Query {
+	q.alias = alias
+	return q
+}
+
+// Select adds a column of expr named alias. Without any columns, the query selects *.
+func (q *Query) Select(expr *cel.Ast, alias string) *Query {
+	q.projections = append(q.projections, projection{expr: expr, alias: alias})
+	return q
+}
+
+func (q *Query) Where(filter *cel.Ast) *Query {
+	q.filter = filter
+	return q
+}
+
+func (q *Query) OrderBy(expr *cel.Ast, direction SortDirection) *Query {
+	q.sortKeys = append(q.sortKeys, sortKey{expr: expr, direction: direction})
+	return q
+}
+
+// Limit limits the number of rows, which must not be negative.
+func (q *Query) Limit(limit int64) *Query {
+	q.limit = &limit
+	return q
+}
+
+// Offset skips rows, which requires Limit and must not be negative.
+func (q *Query) Offset(offset int64) *Query {
+	q.offset = &offset
+	return q
+}
+
+// Build converts every expression with opts, so a ValueTracker among them collects the parameters of the whole query
+// in the order they appear.
+func (q *Query) Build(opts ...ConvertOption) (string, error) {
+	if q.limit != nil && *q.limit < 0 {
+		return "", fmt.Errorf("negative LIMIT %d", *q.limit)
+	}
+	if q.offset != nil && *q.offset < 0 {
+		return "", fmt.Errorf("negative OFFSET %d", *q.offset)
+	}
+	if q.offset != nil && q.limit == nil {
+		return "", fmt.Errorf("OFFSET requires LIMIT")
+	}
+	con := &Converter{valueTracker: &embedTracker{}}
+	for _, opt := range opts {
+		opt(con)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	if len(q.projections) == 0 {
+		sb.WriteString("*")
+	}
+	for i, p := range q.projections {
+		if p.alias == "" {
+			return "", fmt.Errorf("column %d has no alias", i)
+		}
+		column, err := Convert(p.expr, opts...)
+		if err != nil {
+			return "", fmt.Errorf("column %s: %w", p.alias, err)
+		}
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(column)
+		sb.WriteString(" AS ")
+		sb.WriteString(con.QuoteIdentifier(p.alias))
+	}
+	sb.WriteString(" FROM ")
+	sb.WriteString(con.quoteTableName(q.table))
+	if q.alias != "" {
+		sb.WriteString(" AS ")
+		sb.WriteString(con.QuoteIdentifier(q.alias))
+	}
+	if q.filter != nil {
+		filter, err := Convert(q.filter, opts...)
+		if err != nil {
+			return "", fmt.Errorf("filter: %w", err)
+		}
+		sb.WriteString(" WHERE ")
+		sb.WriteString(filter)
+	}
+	for i, k := range q.sortKeys {
+		key, err := Convert(k.expr, opts...)
+		if err != nil {
+			return "", fmt.Errorf("sort key %d: %w", i, err)
+		}
+		if i == 0 {
+			sb.WriteString(" ORDER BY ")
+		} else {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(key)
+		if k.direction == Descending {
+			sb.WriteString(" DESC")
+		} else {
+			sb.WriteString(" ASC")
+		}
+	}
+	if q.limit != nil {
+		sb.WriteString(" LIMIT ")
+		sb.WriteString(con.valueTracker.AddValue(*q.limit))
+	}
+	if q.offset != nil {
+		sb.WriteString(" OFFSET ")
+		sb.WriteString(con.valueTracker.AddValue(*q.offset))
+	}
+	return sb.String(), nil
+}
+
+// quoteTableName quotes a path of a table. BigQuery accepts project.dataset.table as a single quoted identifier,
+// while Spanner reads it as the name of a table, so the parts of schema.table are quoted separately.
+func (con *Converter) quoteTableName(name string) string {
+	if con.sqlDialect != SpannerSQL {
+		return con.QuoteIdentifier(name)
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = con.QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
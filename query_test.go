@@ -0,0 +1,89 @@
+package cel2sql_test
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockscomb/cel2sql"
+	"github.com/cockscomb/cel2sql/bq"
+	"github.com/cockscomb/cel2sql/dbsql"
+)
+
+func TestQuery(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.Declarations(
+			decls.NewVar("name", decls.String),
+			decls.NewVar("age", decls.Int),
+		),
+	)
+	require.NoError(t, err)
+	compile := func(source string) *cel.Ast {
+		ast, issues := env.Compile(source)
+		require.Empty(t, issues)
+		return ast
+	}
+
+	t.Run("select_all", func(t *testing.T) {
+		got, err := cel2sql.NewQuery("dataset.employees").Where(compile(`age > 20`)).Build()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM `dataset.employees` WHERE `age` > 20", got)
+	})
+
+	t.Run("parameterized", func(t *testing.T) {
+		tracker := bq.NewBigQueryNamedTracker()
+		got, err := cel2sql.NewQuery("employees").As("e").
+			Select(compile(`name + "!"`), "greeting").
+			Select(compile(`age`), "age").
+			Where(compile(`name != "x" && age > 20`)).
+			OrderBy(compile(`age`), cel2sql.Descending).
+			OrderBy(compile(`name`), cel2sql.Ascending).
+			Limit(10).
+			Offset(20).
+			Build(cel2sql.WithValueTracker(tracker), cel2sql.WithDefaultTableAlias("e"))
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT `e`.`name` || @v0t AS `greeting`, `e`.`age` AS `age` FROM `employees` AS `e` "+
+			"WHERE `e`.`name` != @v1t AND `e`.`age` > @v2t ORDER BY `e`.`age` DESC, `e`.`name` ASC LIMIT @v3t OFFSET @v2t", got)
+		values := make([]interface{}, 0, len(tracker.Values))
+		for _, v := range tracker.Values {
+			values = append(values, v.Value)
+		}
+		assert.Equal(t, []interface{}{"!", "x", int64(20), int64(10)}, values)
+	})
+
+	t.Run("positional", func(t *testing.T) {
+		tracker := dbsql.NewMySQLTracker()
+		got, err := cel2sql.NewQuery("employees").
+			Select(compile(`age >= 20`), "adult").
+			Where(compile(`name == "a"`)).
+			Limit(10).
+			Build(cel2sql.WithValueTracker(tracker))
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT `age` >= ? AS `adult` FROM `employees` WHERE `name` = ? LIMIT ?", got)
+		assert.Equal(t, []interface{}{int64(20), "a", int64(10)}, tracker.Args())
+	})
+
+	t.Run("spanner", func(t *testing.T) {
+		got, err := cel2sql.NewQuery("hr.employees").Where(compile(`age > 20`)).Build(cel2sql.WithSQLDialect(cel2sql.SpannerSQL))
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM `hr`.`employees` WHERE `age` > 20", got)
+	})
+
+	t.Run("offset_without_limit", func(t *testing.T) {
+		_, err := cel2sql.NewQuery("employees").Offset(10).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("negative_limit", func(t *testing.T) {
+		_, err := cel2sql.NewQuery("employees").Limit(-1).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("negative_offset", func(t *testing.T) {
+		_, err := cel2sql.NewQuery("employees").Limit(10).Offset(-1).Build()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,273 @@
+package cel2sql
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/google/cel-go/common/operators"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Relationships declare fields of message types which refer to rows of other tables,
+// keyed by the message type and then the field name.
+type Relationships map[string]map[string]Relationship
+
+// Relationship relates a row to the rows of Table whose ForeignKey equals its LocalKey,
+// e.g. Employee.manager is {Table: "`employees`", Type: "Employee", LocalKey: "manager_id", ForeignKey: "id"}.
+// Table is written verbatim, and Type is the message type of its rows. Many relates a row to a list of rows.
+type Relationship struct {
+	Table      string
+	Type       string
+	LocalKey   string
+	ForeignKey string
+	Many       bool
+}
+
+func (r Relationships) Lookup(messageType string, field string) (Relationship, bool) {
+	rel, ok := r[messageType][field]
+	return rel, ok
+}
+
+// selectChain is a.b.c split into the fields and the operands they are selected from, both from the leaf.
+type selectChain struct {
+	rootExpr *exprpb.Expr
+	rootPath []string
+	operands []*exprpb.Expr
+	fields   []string
+}
+
+func newSelectChain(expr *exprpb.Expr) *selectChain {
+	chain := &selectChain{}
+	for e := expr; ; {
+		var operand *exprpb.Expr
+		var field string
+		if ee := e.GetSelectExpr(); ee != nil {
+			operand, field = ee.GetOperand(), ee.GetField()
+		} else if o, f, ok := optionalSelect(e); ok {
+			operand, field = o, f
+		} else if ee := e.GetIdentExpr(); ee != nil {
+			chain.rootPath = []string{ee.GetName()}
+			return chain
+		} else {
+			chain.rootExpr = e
+			return chain
+		}
+		chain.operands = append(chain.operands, operand)
+		chain.fields = append(chain.fields, field)
+		e = operand
+	}
+}
+
+// relationship finds the relationship nearest to the root, returning its index in the chain.
+func (con *Converter) relationship(operands []*exprpb.Expr, fields []string) (int, Relationship) {
+	for i := len(operands) - 1; i >= 0; i-- {
+		msgType := unwrapOptionalType(con.GetType(operands[i])).GetMessageType()
+		if rel, ok := con.relationships.Lookup(msgType, fields[i]); ok {
+			return i, rel
+		}
+	}
+	return -1, Relationship{}
+}
+
+// writeBase writes the root of the chain followed by prefix.
+func (con *Converter) writeBase(chain *selectChain, nested bool) func(prefix []string) error {
+	return func(prefix []string) error {
+		if chain.rootExpr != nil {
+			if err := con.visitMaybeNested(chain.rootExpr, nested); err != nil {
+				return err
+			}
+		}
+		return con.WriteIdent(chain.rootExpr, append(append([]string{}, chain.rootPath...), prefix...))
+	}
+}
+
+// visitRelatedSelect writes a path across relationships as scalar subqueries against the related tables, e.g.
+// employee.manager.name becomes (SELECT _r0.`name` FROM `employees` AS _r0 WHERE _r0.`id` = `employee`.`manager_id`).
+func (con *Converter) visitRelatedSelect(expr *exprpb.Expr) (bool, error) {
+	chain := newSelectChain(expr)
+	if i, _ := con.relationship(chain.operands, chain.fields); i < 0 {
+		return false, nil
+	}
+	nested := !expr.GetSelectExpr().GetTestOnly() && isBinaryOrTernaryOperator(chain.rootExpr)
+	if err := con.writeRelatedPath(con.writeBase(chain, nested), chain.operands, chain.fields); err != nil {
+		return true, err
+	}
+	if expr.GetSelectExpr().GetTestOnly() {
+		con.str.WriteString(" IS NOT NULL")
+	}
+	return true, nil
+}
+
+func (con *Converter) writeRelatedPath(writeBase func(prefix []string) error, operands []*exprpb.Expr, fields []string) error {
+	i, rel := con.relationship(operands, fields)
+	if i < 0 {
+		prefix := append([]string{}, fields...)
+		reverse(prefix)
+		return writeBase(prefix)
+	}
+	alias := "_r" + strconv.Itoa(con.relationDepth)
+	con.relationDepth++
+	defer func() { con.relationDepth-- }()
+
+	if i == 0 {
+		// the whole rows are selected
+		if err := con.authorizeRelatedRow(rel); err != nil {
+			return err
+		}
+	}
+	switch {
+	case i == 0 && rel.Many:
+		con.str.WriteString("ARRAY(SELECT AS STRUCT ")
+		con.str.WriteString(alias)
+		con.str.WriteString(".*")
+	case i == 0:
+		con.str.WriteString("(SELECT AS STRUCT ")
+		con.str.WriteString(alias)
+		con.str.WriteString(".*")
+	case rel.Many:
+		return fmt.Errorf("cannot select %q from the list of %q", fields[i-1], fields[i])
+	default:
+		con.str.WriteString("(SELECT ")
+		if mapped, err := con.writeRelatedMappedField(rel, operands[:i], fields[:i]); mapped || err != nil {
+			if err != nil {
+				return err
+			}
+			break
+		}
+		writeAlias := func(prefix []string) error {
+			masked, err := con.authorizeRelatedAccess(rel, prefix)
+			if err != nil {
+				return err
+			}
+			if masked != "" {
+				con.str.WriteString(masked)
+				return nil
+			}
+			con.str.WriteString(alias)
+			for _, p := range prefix {
+				con.str.WriteString(".")
+				con.str.WriteString(con.QuoteIdentifier(p))
+			}
+			return nil
+		}
+		if err := con.writeRelatedPath(writeAlias, operands[:i], fields[:i]); err != nil {
+			return err
+		}
+	}
+	con.str.WriteString(" FROM ")
+	if err := con.writeRelatedTable(rel, alias, writeBase, operands[i:], fields[i:]); err != nil {
+		return err
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+// writeRelatedMappedField writes the mapped field selected from a row of the related table, if any, within the scalar
+// subquery against the table, so that the columns in its SQL refer to the row.
+func (con *Converter) writeRelatedMappedField(rel Relationship, operands []*exprpb.Expr, fields []string) (bool, error) {
+	if con.fieldMapping == nil {
+		return false, nil
+	}
+	index, field := con.mappedField(operands, fields)
+	if index < 0 {
+		return false, nil
+	}
+	if i, _ := con.relationship(operands, fields); i > index {
+		// the field is mapped in a table related further
+		return false, nil
+	} else if i >= 0 {
+		return true, fmt.Errorf("relationship %q cannot be selected from mapped field %q", fields[i], fields[index])
+	}
+	parent := append([]string{}, fields[index+1:]...)
+	reverse(parent)
+	masked, err := con.authorizeMappedField(parent, field, func(path []string) (string, error) {
+		return con.authorizeRelatedAccess(rel, path)
+	})
+	if err != nil {
+		return true, err
+	}
+	if masked != "" {
+		if index > 0 {
+			return true, fmt.Errorf("cannot select %q from masked field %q", fields[0], fields[index])
+		}
+		con.str.WriteString(masked)
+		return true, nil
+	}
+	con.writeMappedField(field, fields[:index])
+	return true, nil
+}
+
+// writeRelatedTable writes "table AS alias WHERE alias.foreign_key = local_key",
+// where fields[0] is the relationship selected from operands[0].
+func (con *Converter) writeRelatedTable(rel Relationship, alias string, writeBase func(prefix []string) error, operands []*exprpb.Expr, fields []string) error {
+	masked, err := con.authorizeRelatedAccess(rel, []string{rel.ForeignKey})
+	if err != nil {
+		return err
+	}
+	if masked != "" {
+		return fmt.Errorf("cannot join %s by masked field %q", rel.Table, rel.ForeignKey)
+	}
+	con.str.WriteString(rel.Table)
+	con.str.WriteString(" AS ")
+	con.str.WriteString(alias)
+	con.str.WriteString(" WHERE ")
+	con.str.WriteString(alias)
+	con.str.WriteString(".")
+	con.str.WriteString(con.QuoteIdentifier(rel.ForeignKey))
+	con.str.WriteString(" = ")
+	// the local key is selected from the same row as the relationship, which may be across other relationships
+	localFields := append([]string{rel.LocalKey}, fields[1:]...)
+	return con.writeRelatedPath(writeBase, operands, localFields)
+}
+
+// relatedRange returns the relationship when a comprehension iterates over a one-to-many relationship.
+func (con *Converter) relatedRange(iterRange *exprpb.Expr) (*selectChain, Relationship, bool) {
+	if con.relationships == nil || iterRange.GetSelectExpr() == nil {
+		return nil, Relationship{}, false
+	}
+	chain := newSelectChain(iterRange)
+	msgType := unwrapOptionalType(con.GetType(chain.operands[0])).GetMessageType()
+	rel, ok := con.relationships.Lookup(msgType, chain.fields[0])
+	if !ok || !rel.Many {
+		return nil, Relationship{}, false
+	}
+	return chain, rel, true
+}
+
+// writeRelatedRange writes the FROM clause of a comprehension over a one-to-many relationship,
+// which queries the related table aliased by the iteration variable, and the condition if any.
+func (con *Converter) writeRelatedRange(chain *selectChain, rel Relationship, iterVar string, condition *exprpb.Expr) error {
+	nested := isBinaryOrTernaryOperator(chain.rootExpr)
+	if err := con.writeRelatedTable(rel, iterVar, con.writeBase(chain, nested), chain.operands, chain.fields); err != nil {
+		return err
+	}
+	if condition == nil {
+		return nil
+	}
+	con.str.WriteString(" AND ")
+	return con.visitMaybeNested(condition, isComplexOperatorWithRespectTo(operators.LogicalAnd, condition))
+}
+
+// authorizeRelatedAccess authorizes path of a row of the related table, which is empty for the whole row.
+func (con *Converter) authorizeRelatedAccess(rel Relationship, path []string) (string, error) {
+	if con.identAuthorizer == nil {
+		return "", nil
+	}
+	authorizer, ok := con.identAuthorizer.(RelatedIdentAuthorizer)
+	if !ok {
+		return "", fmt.Errorf("the IdentAuthorizer cannot authorize the access to %s", rel.Table)
+	}
+	return authorizer.AuthorizeRelatedAccess(rel, path)
+}
+
+// authorizeRelatedRow authorizes the reference to whole rows of the related table, which cannot be masked.
+func (con *Converter) authorizeRelatedRow(rel Relationship) error {
+	masked, err := con.authorizeRelatedAccess(rel, nil)
+	if err != nil {
+		return err
+	}
+	if masked != "" {
+		return fmt.Errorf("cannot reference the rows of %s masked as a whole", rel.Table)
+	}
+	return nil
+}
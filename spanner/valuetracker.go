@@ -0,0 +1,174 @@
+// Package spanner provides a value tracker which binds the values of converted filters as Cloud Spanner query parameters.
+package spanner
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/google/cel-go/checker/decls"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+
+	"github.com/cockscomb/cel2sql"
+)
+
+// Statement has the same fields as spanner.Statement, so it can be converted by spanner.Statement(stmt).
+type Statement struct {
+	SQL    string
+	Params map[string]interface{}
+}
+
+type SpannerNamedTracker struct {
+	Params map[string]interface{}
+	names  map[interface{}]string
+}
+
+func NewSpannerNamedTracker() *SpannerNamedTracker {
+	return &SpannerNamedTracker{Params: map[string]interface{}{}, names: map[interface{}]string{}}
+}
+
+func (t *SpannerNamedTracker) AddValue(val interface{}) string {
+	if val == nil {
+		// an untyped NULL cannot be passed as a parameter
+		return "NULL"
+	}
+	val = encode(val)
+	key := cel2sql.ValueKey(val)
+	if name, ok := t.names[key]; ok {
+		return "@" + name
+	}
+	name := fmt.Sprintf("v%d", len(t.Params))
+	t.Params[name] = val
+	t.names[key] = name
+	return "@" + name
+}
+
+// AddTypedValue binds NULLs as nil pointers and empty lists as empty slices of the Go type corresponding to typ.
+func (t *SpannerNamedTracker) AddTypedValue(val interface{}, typ *exprpb.Type) string {
+	list, isList := val.([]interface{})
+	if val != nil && (!isList || len(list) > 0) {
+		return t.AddValue(val)
+	}
+	if isList {
+		elemType := goType(typ.GetListType().GetElemType())
+		if elemType == nil {
+			return "[]"
+		}
+		return t.AddValue(reflect.MakeSlice(reflect.SliceOf(elemType), 0, 0).Interface())
+	}
+	nullType := goType(typ)
+	if nullType == nil {
+		return t.AddValue(val)
+	}
+	if nullType.Kind() != reflect.Slice {
+		nullType = reflect.PtrTo(nullType)
+	}
+	return t.AddValue(reflect.Zero(nullType).Interface())
+}
+
+// goType returns the Go type which the Spanner client binds as the Spanner type corresponding to typ.
+func goType(typ *exprpb.Type) reflect.Type {
+	if wrapper := typ.GetWrapper(); wrapper != exprpb.Type_PRIMITIVE_TYPE_UNSPECIFIED {
+		typ = decls.NewPrimitiveType(wrapper)
+	}
+	switch typ.GetPrimitive() {
+	case exprpb.Type_BOOL:
+		return reflect.TypeOf(false)
+	case exprpb.Type_INT64, exprpb.Type_UINT64:
+		return reflect.TypeOf(int64(0))
+	case exprpb.Type_DOUBLE:
+		return reflect.TypeOf(float64(0))
+	case exprpb.Type_STRING:
+		return reflect.TypeOf("")
+	case exprpb.Type_BYTES:
+		return reflect.TypeOf([]byte(nil))
+	}
+	if typ.GetWellKnown() == exprpb.Type_TIMESTAMP {
+		return reflect.TypeOf(time.Time{})
+	}
+	switch typ.GetAbstractType().GetName() {
+	case "DATE":
+		return reflect.TypeOf(civil.Date{})
+	case "DATETIME":
+		return reflect.TypeOf(time.Time{})
+	case "TIME":
+		return reflect.TypeOf("")
+	}
+	return nil
+}
+
+// Statement wraps sql, which contains the converted filter, with the tracked parameters.
+func (t *SpannerNamedTracker) Statement(sql string) Statement {
+	params := make(map[string]interface{}, len(t.Params))
+	for name, v := range t.Params {
+		params[name] = v
+	}
+	return Statement{SQL: sql, Params: params}
+}
+
+// encode converts val into a type the Spanner client binds as the corresponding Spanner type.
+func encode(val interface{}) interface{} {
+	switch v := val.(type) {
+	case uint64:
+		if v > math.MaxInt64 {
+			// NUMERIC
+			return *new(big.Rat).SetUint64(v)
+		}
+		return int64(v)
+	case time.Time:
+		return v.UTC()
+	case civil.DateTime:
+		// Spanner has no DATETIME type
+		return v.In(time.UTC)
+	case civil.Time:
+		// Spanner has no TIME type
+		return time.Date(0, 1, 1, v.Hour, v.Minute, v.Second, v.Nanosecond, time.UTC).Format("15:04:05.999999999")
+	case []interface{}:
+		return encodeArray(v)
+	default:
+		return v
+	}
+}
+
+// encodeArray converts a list into a typed slice like []string, since the Spanner client cannot bind []interface{}.
+func encodeArray(list []interface{}) interface{} {
+	if len(list) == 0 {
+		return list
+	}
+	numeric := false
+	for _, elem := range list {
+		if v, ok := elem.(uint64); ok && v > math.MaxInt64 {
+			numeric = true
+		}
+	}
+	elems := make([]interface{}, len(list))
+	var elemType reflect.Type
+	for i, elem := range list {
+		if elem == nil {
+			return list
+		}
+		elems[i] = encode(elem)
+		if numeric {
+			// widen to NUMERIC, so that the array has a single type
+			switch v := elem.(type) {
+			case uint64:
+				elems[i] = *new(big.Rat).SetUint64(v)
+			case int64:
+				elems[i] = *new(big.Rat).SetInt64(v)
+			}
+		}
+		if elemType == nil {
+			elemType = reflect.TypeOf(elems[i])
+		} else if elemType != reflect.TypeOf(elems[i]) {
+			return list
+		}
+	}
+	array := reflect.MakeSlice(reflect.SliceOf(elemType), len(elems), len(elems))
+	for i, elem := range elems {
+		array.Index(i).Set(reflect.ValueOf(elem))
+	}
+	return array.Interface()
+}
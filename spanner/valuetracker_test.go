@@ -0,0 +1,138 @@
+package spanner_test
+
+import (
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockscomb/cel2sql"
+	"github.com/cockscomb/cel2sql/spanner"
+	"github.com/cockscomb/cel2sql/sqltypes"
+)
+
+func TestSpannerNamedTracker_Statement(t *testing.T) {
+	env, err := cel.NewEnv(
+		sqltypes.SQLTypeDeclarations,
+		cel.Declarations(
+			decls.NewVar("name", decls.String),
+			decls.NewVar("nickname", decls.String),
+			decls.NewVar("birthday", sqltypes.Date),
+			decls.NewVar("created_at", decls.Timestamp),
+		),
+	)
+	require.NoError(t, err)
+	ast, issues := env.Compile(`name == "a" && nickname == "a" && birthday > date("2000-01-01") && ` +
+		`created_at > timestamp("2023-01-01T09:00:00+09:00")`)
+	require.Empty(t, issues)
+
+	tracker := spanner.NewSpannerNamedTracker()
+	got, err := cel2sql.Convert(ast, cel2sql.WithValueTracker(tracker), cel2sql.WithSQLDialect(cel2sql.SpannerSQL))
+	require.NoError(t, err)
+	assert.Equal(t, spanner.Statement{
+		SQL: "SELECT * FROM Users WHERE `name` = @v0 AND `nickname` = @v0 AND `birthday` > @v1 AND `created_at` > @v2",
+		Params: map[string]interface{}{
+			"v0": "a",
+			"v1": civil.Date{Year: 2000, Month: 1, Day: 1},
+			"v2": time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}, tracker.Statement("SELECT * FROM Users WHERE "+got))
+}
+
+func TestSpannerNamedTracker_AddValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		val       interface{}
+		want      string
+		wantParam interface{}
+	}{
+		{
+			name: "null",
+			val:  nil,
+			want: "NULL",
+		},
+		{
+			name:      "uint64",
+			val:       uint64(1),
+			want:      "@v0",
+			wantParam: int64(1),
+		},
+		{
+			name:      "numeric",
+			val:       uint64(math.MaxUint64),
+			want:      "@v0",
+			wantParam: *new(big.Rat).SetUint64(math.MaxUint64),
+		},
+		{
+			name:      "datetime",
+			val:       civil.DateTime{Date: civil.Date{Year: 2023, Month: 1, Day: 1}, Time: civil.Time{Hour: 12}},
+			want:      "@v0",
+			wantParam: time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "time",
+			val:       civil.Time{Hour: 12, Minute: 30, Nanosecond: 500000000},
+			want:      "@v0",
+			wantParam: "12:30:00.5",
+		},
+		{
+			name:      "uint_array",
+			val:       []interface{}{uint64(1), uint64(2)},
+			want:      "@v0",
+			wantParam: []int64{1, 2},
+		},
+		{
+			name:      "numeric_array",
+			val:       []interface{}{uint64(1), uint64(math.MaxUint64)},
+			want:      "@v0",
+			wantParam: []big.Rat{*big.NewRat(1, 1), *new(big.Rat).SetUint64(math.MaxUint64)},
+		},
+		{
+			name:      "string_array",
+			val:       []interface{}{"a", "b"},
+			want:      "@v0",
+			wantParam: []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := spanner.NewSpannerNamedTracker()
+			assert.Equal(t, tt.want, tracker.AddValue(tt.val))
+			if tt.wantParam != nil {
+				assert.Equal(t, map[string]interface{}{"v0": tt.wantParam}, tracker.Params)
+			} else {
+				assert.Empty(t, tracker.Params)
+			}
+		})
+	}
+}
+
+func TestSpannerNamedTracker_AddTypedValue(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.OptionalTypes(),
+		sqltypes.SQLTypeDeclarations,
+		cel.Declarations(
+			decls.NewVar("name", decls.String),
+			decls.NewVar("birthday", sqltypes.Date),
+		),
+	)
+	require.NoError(t, err)
+	ast, issues := env.Compile(`!(birthday in []) && optional.none().orValue(name) == "a"`)
+	require.Empty(t, issues)
+
+	tracker := spanner.NewSpannerNamedTracker()
+	got, err := cel2sql.Convert(ast, cel2sql.WithValueTracker(tracker), cel2sql.WithSQLDialect(cel2sql.SpannerSQL))
+	require.NoError(t, err)
+	assert.Equal(t, "NOT (`birthday` IN UNNEST(@v0)) AND IFNULL(@v1, `name`) = @v2", got)
+	assert.Equal(t, map[string]interface{}{
+		"v0": []civil.Date{},
+		"v1": (*string)(nil),
+		"v2": "a",
+	}, tracker.Params)
+}
@@ -1,8 +1,11 @@
 package sqltypes
 
 import (
+	"regexp"
+
 	"github.com/google/cel-go/cel"
 	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common"
 	"github.com/google/cel-go/common/operators"
 	"github.com/google/cel-go/common/overloads"
 	"github.com/google/cel-go/parser"
@@ -18,7 +21,8 @@ var (
 )
 
 var (
-	typeV = decls.NewTypeParamType("V")
+	typeV   = decls.NewTypeParamType("V")
+	listOfV = decls.NewListType(typeV)
 )
 
 func newConstantString(str string) *expr.Constant {
@@ -111,6 +115,11 @@ var SQLTypeDeclarations = cel.Declarations(
 		decls.NewOverload("greater_equals_time", []*expr.Type{Time, Time}, decls.Bool),
 		decls.NewOverload("greater_equals_datetime", []*expr.Type{DateTime, DateTime}, decls.Bool),
 	),
+	// implicit coercions between DATE, DATETIME, TIMESTAMP and ISO 8601 strings, which are resolved by the converter
+	newTemporalComparison(operators.Less, "less"),
+	newTemporalComparison(operators.LessEquals, "less_equals"),
+	newTemporalComparison(operators.Greater, "greater"),
+	newTemporalComparison(operators.GreaterEquals, "greater_equals"),
 	decls.NewFunction(operators.Add,
 		decls.NewOverload("add_date_int", []*expr.Type{Date, decls.Int}, Date),
 		decls.NewOverload("add_int_date", []*expr.Type{decls.Int, Date}, Date),
@@ -143,6 +152,11 @@ var SQLTypeDeclarations = cel.Declarations(
 		decls.NewOverload("subtract_datetime_duration", []*expr.Type{DateTime, decls.Duration}, DateTime),
 		decls.NewOverload("subtract_timestamp_interval", []*expr.Type{decls.Timestamp, Interval}, decls.Timestamp),
 	),
+	decls.NewFunction(operators.Subtract,
+		decls.NewOverload("subtract_date_date", []*expr.Type{Date, Date}, decls.Duration),
+		decls.NewOverload("subtract_time_time", []*expr.Type{Time, Time}, decls.Duration),
+		decls.NewOverload("subtract_datetime_datetime", []*expr.Type{DateTime, DateTime}, decls.Duration),
+	),
 
 	decls.NewFunction("interval",
 		decls.NewOverload("interval_construct", []*expr.Type{decls.Int, DatePart}, Interval),
@@ -152,6 +166,9 @@ var SQLTypeDeclarations = cel.Declarations(
 	decls.NewFunction("date",
 		decls.NewOverload("date_construct_year_month_day", []*expr.Type{decls.Int, decls.Int, decls.Int}, Date),
 		decls.NewOverload("date_construct_string", []*expr.Type{decls.String}, Date),
+		decls.NewOverload("date_construct_datetime", []*expr.Type{DateTime}, Date),
+		decls.NewOverload("date_construct_timestamp", []*expr.Type{decls.Timestamp}, Date),
+		decls.NewOverload("date_construct_timestamp_timezone", []*expr.Type{decls.Timestamp, decls.String}, Date),
 	),
 	decls.NewFunction("current_date",
 		decls.NewOverload("current_date", []*expr.Type{}, Date),
@@ -199,6 +216,274 @@ var SQLTypeDeclarations = cel.Declarations(
 		decls.NewInstanceOverload("time_trunc", []*expr.Type{Time, DatePart}, Time),
 		decls.NewInstanceOverload("datetime_trunc", []*expr.Type{DateTime, DatePart}, DateTime),
 		decls.NewInstanceOverload("timestamp_trunc", []*expr.Type{decls.Timestamp, DatePart}, decls.Timestamp),
+		decls.NewInstanceOverload("timestamp_trunc_timezone", []*expr.Type{decls.Timestamp, DatePart, decls.String}, decls.Timestamp),
+	),
+	// date/time function library
+	// https://cloud.google.com/bigquery/docs/reference/standard-sql/date_functions
+	decls.NewFunction("date_add",
+		decls.NewOverload("date_add_interval", []*expr.Type{Date, Interval}, Date),
+		decls.NewOverload("date_add_duration", []*expr.Type{Date, decls.Duration}, Date),
+	),
+	decls.NewFunction("date_sub",
+		decls.NewOverload("date_sub_interval", []*expr.Type{Date, Interval}, Date),
+		decls.NewOverload("date_sub_duration", []*expr.Type{Date, decls.Duration}, Date),
+	),
+	decls.NewFunction("date_diff",
+		decls.NewOverload("date_diff_date_date_part", []*expr.Type{Date, Date, DatePart}, decls.Int),
+	),
+	decls.NewFunction("date_trunc",
+		decls.NewOverload("date_trunc_date_part", []*expr.Type{Date, DatePart}, Date),
+	),
+	decls.NewFunction("date_bucket",
+		decls.NewOverload("date_bucket_interval", []*expr.Type{Date, Interval}, Date),
+		decls.NewOverload("date_bucket_duration", []*expr.Type{Date, decls.Duration}, Date),
+		decls.NewOverload("date_bucket_interval_origin", []*expr.Type{Date, Interval, Date}, Date),
+		decls.NewOverload("date_bucket_duration_origin", []*expr.Type{Date, decls.Duration, Date}, Date),
+	),
+	decls.NewFunction("date_from_unix_date",
+		decls.NewOverload("date_from_unix_date_int", []*expr.Type{decls.Int}, Date),
+	),
+	decls.NewFunction("unix_date",
+		decls.NewOverload("unix_date_date", []*expr.Type{Date}, decls.Int),
+	),
+	decls.NewFunction("format_date",
+		decls.NewOverload("format_date_string_date", []*expr.Type{decls.String, Date}, decls.String),
+	),
+	decls.NewFunction("parse_date",
+		decls.NewOverload("parse_date_string_string", []*expr.Type{decls.String, decls.String}, Date),
+	),
+	decls.NewFunction("last_day",
+		decls.NewOverload("last_day_date", []*expr.Type{Date}, Date),
+		decls.NewOverload("last_day_date_date_part", []*expr.Type{Date, DatePart}, Date),
+		decls.NewOverload("last_day_datetime", []*expr.Type{DateTime}, Date),
+		decls.NewOverload("last_day_datetime_date_part", []*expr.Type{DateTime, DatePart}, Date),
+	),
+	decls.NewFunction("generate_date_array",
+		decls.NewOverload("generate_date_array_date_date", []*expr.Type{Date, Date}, decls.NewListType(Date)),
+		decls.NewOverload("generate_date_array_date_date_interval", []*expr.Type{Date, Date, Interval}, decls.NewListType(Date)),
+		decls.NewOverload("generate_date_array_date_date_duration", []*expr.Type{Date, Date, decls.Duration}, decls.NewListType(Date)),
+	),
+	// https://cloud.google.com/bigquery/docs/reference/standard-sql/datetime_functions
+	decls.NewFunction("datetime_add",
+		decls.NewOverload("datetime_add_interval", []*expr.Type{DateTime, Interval}, DateTime),
+		decls.NewOverload("datetime_add_duration", []*expr.Type{DateTime, decls.Duration}, DateTime),
+	),
+	decls.NewFunction("datetime_sub",
+		decls.NewOverload("datetime_sub_interval", []*expr.Type{DateTime, Interval}, DateTime),
+		decls.NewOverload("datetime_sub_duration", []*expr.Type{DateTime, decls.Duration}, DateTime),
+	),
+	decls.NewFunction("datetime_diff",
+		decls.NewOverload("datetime_diff_datetime_datetime_date_part", []*expr.Type{DateTime, DateTime, DatePart}, decls.Int),
+	),
+	decls.NewFunction("datetime_trunc",
+		decls.NewOverload("datetime_trunc_date_part", []*expr.Type{DateTime, DatePart}, DateTime),
+	),
+	decls.NewFunction("datetime_bucket",
+		decls.NewOverload("datetime_bucket_interval", []*expr.Type{DateTime, Interval}, DateTime),
+		decls.NewOverload("datetime_bucket_duration", []*expr.Type{DateTime, decls.Duration}, DateTime),
+		decls.NewOverload("datetime_bucket_interval_origin", []*expr.Type{DateTime, Interval, DateTime}, DateTime),
+		decls.NewOverload("datetime_bucket_duration_origin", []*expr.Type{DateTime, decls.Duration, DateTime}, DateTime),
+	),
+	decls.NewFunction("format_datetime",
+		decls.NewOverload("format_datetime_string_datetime", []*expr.Type{decls.String, DateTime}, decls.String),
+	),
+	decls.NewFunction("parse_datetime",
+		decls.NewOverload("parse_datetime_string_string", []*expr.Type{decls.String, decls.String}, DateTime),
+	),
+	// https://cloud.google.com/bigquery/docs/reference/standard-sql/time_functions
+	decls.NewFunction("time_add",
+		decls.NewOverload("time_add_interval", []*expr.Type{Time, Interval}, Time),
+		decls.NewOverload("time_add_duration", []*expr.Type{Time, decls.Duration}, Time),
+	),
+	decls.NewFunction("time_sub",
+		decls.NewOverload("time_sub_interval", []*expr.Type{Time, Interval}, Time),
+		decls.NewOverload("time_sub_duration", []*expr.Type{Time, decls.Duration}, Time),
+	),
+	decls.NewFunction("time_diff",
+		decls.NewOverload("time_diff_time_time_date_part", []*expr.Type{Time, Time, DatePart}, decls.Int),
+	),
+	decls.NewFunction("time_trunc",
+		decls.NewOverload("time_trunc_date_part", []*expr.Type{Time, DatePart}, Time),
+	),
+	decls.NewFunction("format_time",
+		decls.NewOverload("format_time_string_time", []*expr.Type{decls.String, Time}, decls.String),
+	),
+	decls.NewFunction("parse_time",
+		decls.NewOverload("parse_time_string_string", []*expr.Type{decls.String, decls.String}, Time),
+	),
+	// https://cloud.google.com/bigquery/docs/reference/standard-sql/timestamp_functions
+	decls.NewFunction("timestamp_add",
+		decls.NewOverload("timestamp_add_interval", []*expr.Type{decls.Timestamp, Interval}, decls.Timestamp),
+		decls.NewOverload("timestamp_add_duration", []*expr.Type{decls.Timestamp, decls.Duration}, decls.Timestamp),
+	),
+	decls.NewFunction("timestamp_sub",
+		decls.NewOverload("timestamp_sub_interval", []*expr.Type{decls.Timestamp, Interval}, decls.Timestamp),
+		decls.NewOverload("timestamp_sub_duration", []*expr.Type{decls.Timestamp, decls.Duration}, decls.Timestamp),
+	),
+	decls.NewFunction("timestamp_diff",
+		decls.NewOverload("timestamp_diff_timestamp_timestamp_date_part", []*expr.Type{decls.Timestamp, decls.Timestamp, DatePart}, decls.Int),
+	),
+	decls.NewFunction("timestamp_trunc",
+		decls.NewOverload("timestamp_trunc_date_part", []*expr.Type{decls.Timestamp, DatePart}, decls.Timestamp),
+		decls.NewOverload("timestamp_trunc_date_part_timezone", []*expr.Type{decls.Timestamp, DatePart, decls.String}, decls.Timestamp),
+	),
+	decls.NewFunction("timestamp_bucket",
+		decls.NewOverload("timestamp_bucket_interval", []*expr.Type{decls.Timestamp, Interval}, decls.Timestamp),
+		decls.NewOverload("timestamp_bucket_duration", []*expr.Type{decls.Timestamp, decls.Duration}, decls.Timestamp),
+		decls.NewOverload("timestamp_bucket_interval_origin", []*expr.Type{decls.Timestamp, Interval, decls.Timestamp}, decls.Timestamp),
+		decls.NewOverload("timestamp_bucket_duration_origin", []*expr.Type{decls.Timestamp, decls.Duration, decls.Timestamp}, decls.Timestamp),
+	),
+	decls.NewFunction("format_timestamp",
+		decls.NewOverload("format_timestamp_string_timestamp", []*expr.Type{decls.String, decls.Timestamp}, decls.String),
+		decls.NewOverload("format_timestamp_string_timestamp_timezone", []*expr.Type{decls.String, decls.Timestamp, decls.String}, decls.String),
+	),
+	decls.NewFunction("parse_timestamp",
+		decls.NewOverload("parse_timestamp_string_string", []*expr.Type{decls.String, decls.String}, decls.Timestamp),
+		decls.NewOverload("parse_timestamp_string_string_timezone", []*expr.Type{decls.String, decls.String, decls.String}, decls.Timestamp),
+	),
+	decls.NewFunction("timestamp_seconds",
+		decls.NewOverload("timestamp_seconds_int", []*expr.Type{decls.Int}, decls.Timestamp),
+	),
+	decls.NewFunction("timestamp_millis",
+		decls.NewOverload("timestamp_millis_int", []*expr.Type{decls.Int}, decls.Timestamp),
+	),
+	decls.NewFunction("timestamp_micros",
+		decls.NewOverload("timestamp_micros_int", []*expr.Type{decls.Int}, decls.Timestamp),
+	),
+	decls.NewFunction("unix_seconds",
+		decls.NewOverload("unix_seconds_timestamp", []*expr.Type{decls.Timestamp}, decls.Int),
+	),
+	decls.NewFunction("unix_millis",
+		decls.NewOverload("unix_millis_timestamp", []*expr.Type{decls.Timestamp}, decls.Int),
+	),
+	decls.NewFunction("unix_micros",
+		decls.NewOverload("unix_micros_timestamp", []*expr.Type{decls.Timestamp}, decls.Int),
+	),
+	decls.NewFunction("generate_timestamp_array",
+		decls.NewOverload("generate_timestamp_array_interval", []*expr.Type{decls.Timestamp, decls.Timestamp, Interval}, decls.NewListType(decls.Timestamp)),
+		decls.NewOverload("generate_timestamp_array_duration", []*expr.Type{decls.Timestamp, decls.Timestamp, decls.Duration}, decls.NewListType(decls.Timestamp)),
+	),
+	// mathematical functions
+	// https://cloud.google.com/bigquery/docs/reference/standard-sql/mathematical_functions
+	decls.NewFunction("abs",
+		decls.NewOverload("int_abs", []*expr.Type{decls.Int}, decls.Int),
+		decls.NewOverload("double_abs", []*expr.Type{decls.Double}, decls.Double),
+	),
+	decls.NewFunction("sign",
+		decls.NewOverload("int_sign", []*expr.Type{decls.Int}, decls.Int),
+		decls.NewOverload("double_sign", []*expr.Type{decls.Double}, decls.Double),
+	),
+	decls.NewFunction("round",
+		decls.NewOverload("double_round", []*expr.Type{decls.Double}, decls.Double),
+		decls.NewOverload("double_round_precision", []*expr.Type{decls.Double, decls.Int}, decls.Double),
+	),
+	decls.NewFunction("trunc",
+		decls.NewOverload("double_trunc", []*expr.Type{decls.Double}, decls.Double),
+		decls.NewOverload("double_trunc_precision", []*expr.Type{decls.Double, decls.Int}, decls.Double),
+	),
+	decls.NewFunction("ceil",
+		decls.NewOverload("double_ceil", []*expr.Type{decls.Double}, decls.Double),
+	),
+	decls.NewFunction("floor",
+		decls.NewOverload("double_floor", []*expr.Type{decls.Double}, decls.Double),
+	),
+	decls.NewFunction("sqrt",
+		decls.NewOverload("int_sqrt", []*expr.Type{decls.Int}, decls.Double),
+		decls.NewOverload("double_sqrt", []*expr.Type{decls.Double}, decls.Double),
+	),
+	decls.NewFunction("pow",
+		decls.NewOverload("int_pow_int", []*expr.Type{decls.Int, decls.Int}, decls.Double),
+		decls.NewOverload("double_pow_double", []*expr.Type{decls.Double, decls.Double}, decls.Double),
+	),
+	decls.NewFunction("exp",
+		decls.NewOverload("int_exp", []*expr.Type{decls.Int}, decls.Double),
+		decls.NewOverload("double_exp", []*expr.Type{decls.Double}, decls.Double),
+	),
+	decls.NewFunction("ln",
+		decls.NewOverload("int_ln", []*expr.Type{decls.Int}, decls.Double),
+		decls.NewOverload("double_ln", []*expr.Type{decls.Double}, decls.Double),
+	),
+	decls.NewFunction("log",
+		decls.NewOverload("int_log", []*expr.Type{decls.Int}, decls.Double),
+		decls.NewOverload("double_log", []*expr.Type{decls.Double}, decls.Double),
+		decls.NewOverload("double_log_base", []*expr.Type{decls.Double, decls.Double}, decls.Double),
+	),
+	decls.NewFunction("log10",
+		decls.NewOverload("int_log10", []*expr.Type{decls.Int}, decls.Double),
+		decls.NewOverload("double_log10", []*expr.Type{decls.Double}, decls.Double),
+	),
+	decls.NewFunction("is_inf",
+		decls.NewOverload("double_is_inf", []*expr.Type{decls.Double}, decls.Bool),
+	),
+	decls.NewFunction("is_nan",
+		decls.NewOverload("double_is_nan", []*expr.Type{decls.Double}, decls.Bool),
+	),
+	decls.NewFunction("mod",
+		decls.NewOverload("int_mod_int", []*expr.Type{decls.Int, decls.Int}, decls.Int),
+	),
+	decls.NewFunction("div",
+		decls.NewOverload("int_div_int", []*expr.Type{decls.Int, decls.Int}, decls.Int),
+	),
+	decls.NewFunction("safe_divide",
+		decls.NewOverload("int_safe_divide_int", []*expr.Type{decls.Int, decls.Int}, decls.Double),
+		decls.NewOverload("double_safe_divide_double", []*expr.Type{decls.Double, decls.Double}, decls.Double),
+	),
+	decls.NewFunction("ieee_divide",
+		decls.NewOverload("int_ieee_divide_int", []*expr.Type{decls.Int, decls.Int}, decls.Double),
+		decls.NewOverload("double_ieee_divide_double", []*expr.Type{decls.Double, decls.Double}, decls.Double),
+	),
+	decls.NewFunction("safe_add",
+		decls.NewOverload("int_safe_add_int", []*expr.Type{decls.Int, decls.Int}, decls.Int),
+		decls.NewOverload("double_safe_add_double", []*expr.Type{decls.Double, decls.Double}, decls.Double),
+	),
+	decls.NewFunction("safe_subtract",
+		decls.NewOverload("int_safe_subtract_int", []*expr.Type{decls.Int, decls.Int}, decls.Int),
+		decls.NewOverload("double_safe_subtract_double", []*expr.Type{decls.Double, decls.Double}, decls.Double),
+	),
+	decls.NewFunction("safe_multiply",
+		decls.NewOverload("int_safe_multiply_int", []*expr.Type{decls.Int, decls.Int}, decls.Int),
+		decls.NewOverload("double_safe_multiply_double", []*expr.Type{decls.Double, decls.Double}, decls.Double),
+	),
+	decls.NewFunction("safe_negate",
+		decls.NewOverload("int_safe_negate", []*expr.Type{decls.Int}, decls.Int),
+		decls.NewOverload("double_safe_negate", []*expr.Type{decls.Double}, decls.Double),
+	),
+	// greatest() and least() accept any number of arguments, which the macros pass as a list like ext.Math
+	decls.NewFunction("greatest",
+		decls.NewParameterizedOverload("greatest_list", []*expr.Type{listOfV}, typeV, []string{"V"}),
+	),
+	decls.NewFunction("least",
+		decls.NewParameterizedOverload("least_list", []*expr.Type{listOfV}, typeV, []string{"V"}),
+	),
+	// relative time helpers
+	decls.NewFunction("ago",
+		decls.NewOverload("ago_duration", []*expr.Type{decls.Duration}, decls.Timestamp),
+		decls.NewOverload("ago_duration_timezone", []*expr.Type{decls.Duration, decls.String}, decls.Timestamp),
+		decls.NewOverload("ago_interval", []*expr.Type{Interval}, decls.Timestamp),
+		decls.NewOverload("ago_interval_timezone", []*expr.Type{Interval, decls.String}, decls.Timestamp),
+	),
+	decls.NewFunction("within_last",
+		decls.NewOverload("timestamp_within_last_duration", []*expr.Type{decls.Timestamp, decls.Duration}, decls.Bool),
+		decls.NewOverload("timestamp_within_last_duration_timezone", []*expr.Type{decls.Timestamp, decls.Duration, decls.String}, decls.Bool),
+		decls.NewOverload("timestamp_within_last_interval", []*expr.Type{decls.Timestamp, Interval}, decls.Bool),
+		decls.NewOverload("timestamp_within_last_interval_timezone", []*expr.Type{decls.Timestamp, Interval, decls.String}, decls.Bool),
+		decls.NewOverload("date_within_last_duration", []*expr.Type{Date, decls.Duration}, decls.Bool),
+		decls.NewOverload("date_within_last_duration_timezone", []*expr.Type{Date, decls.Duration, decls.String}, decls.Bool),
+		decls.NewOverload("date_within_last_interval", []*expr.Type{Date, Interval}, decls.Bool),
+		decls.NewOverload("date_within_last_interval_timezone", []*expr.Type{Date, Interval, decls.String}, decls.Bool),
+	),
+	decls.NewFunction("today",
+		decls.NewOverload("today", []*expr.Type{}, decls.Timestamp),
+		decls.NewOverload("today_timezone", []*expr.Type{decls.String}, decls.Timestamp),
+	),
+	decls.NewFunction("start_of",
+		decls.NewOverload("timestamp_start_of", []*expr.Type{decls.Timestamp, DatePart}, decls.Timestamp),
+		decls.NewOverload("timestamp_start_of_timezone", []*expr.Type{decls.Timestamp, DatePart, decls.String}, decls.Timestamp),
+		decls.NewOverload("date_start_of", []*expr.Type{Date, DatePart}, Date),
+		decls.NewOverload("datetime_start_of", []*expr.Type{DateTime, DatePart}, DateTime),
+	),
+	decls.NewFunction("between",
+		decls.NewParameterizedOverload("between", []*expr.Type{typeV, typeV, typeV}, decls.Bool, []string{"V"}),
 	),
 	// https://cloud.google.com/bigquery/docs/reference/standard-sql/string_functions
 	decls.NewFunction("ascii",
@@ -348,6 +633,75 @@ var SQLTypeDeclarations = cel.Declarations(
 		decls.NewOverload("bytes_soundex", []*expr.Type{decls.String}, decls.String),
 	),
 
+	// conditional expressions
+	// https://cloud.google.com/bigquery/docs/reference/standard-sql/conditional_expressions
+	// coalesce() accepts any number of arguments, which its macro passes as a list
+	decls.NewFunction("coalesce",
+		decls.NewParameterizedOverload("coalesce_list", []*expr.Type{listOfV}, typeV, []string{"V"}),
+	),
+	decls.NewFunction("ifnull",
+		decls.NewParameterizedOverload("ifnull", []*expr.Type{typeV, typeV}, typeV, []string{"V"}),
+	),
+	decls.NewFunction("nullif",
+		decls.NewParameterizedOverload("nullif", []*expr.Type{typeV, typeV}, typeV, []string{"V"}),
+	),
+
+	// hash functions
+	// https://cloud.google.com/bigquery/docs/reference/standard-sql/hash_functions
+	decls.NewFunction("farm_fingerprint",
+		decls.NewOverload("string_farm_fingerprint", []*expr.Type{decls.String}, decls.Int),
+		decls.NewOverload("bytes_farm_fingerprint", []*expr.Type{decls.Bytes}, decls.Int),
+	),
+	decls.NewFunction("md5",
+		decls.NewOverload("string_md5", []*expr.Type{decls.String}, decls.Bytes),
+		decls.NewOverload("bytes_md5", []*expr.Type{decls.Bytes}, decls.Bytes),
+	),
+	decls.NewFunction("sha1",
+		decls.NewOverload("string_sha1", []*expr.Type{decls.String}, decls.Bytes),
+		decls.NewOverload("bytes_sha1", []*expr.Type{decls.Bytes}, decls.Bytes),
+	),
+	decls.NewFunction("sha256",
+		decls.NewOverload("string_sha256", []*expr.Type{decls.String}, decls.Bytes),
+		decls.NewOverload("bytes_sha256", []*expr.Type{decls.Bytes}, decls.Bytes),
+	),
+	decls.NewFunction("sha512",
+		decls.NewOverload("string_sha512", []*expr.Type{decls.String}, decls.Bytes),
+		decls.NewOverload("bytes_sha512", []*expr.Type{decls.Bytes}, decls.Bytes),
+	),
+
+	// net functions
+	// https://cloud.google.com/bigquery/docs/reference/standard-sql/net_functions
+	decls.NewFunction("net.host",
+		decls.NewOverload("net_host_string", []*expr.Type{decls.String}, decls.String),
+	),
+	decls.NewFunction("net.reg_domain",
+		decls.NewOverload("net_reg_domain_string", []*expr.Type{decls.String}, decls.String),
+	),
+	decls.NewFunction("net.public_suffix",
+		decls.NewOverload("net_public_suffix_string", []*expr.Type{decls.String}, decls.String),
+	),
+	decls.NewFunction("net.ip_from_string",
+		decls.NewOverload("net_ip_from_string_string", []*expr.Type{decls.String}, decls.Bytes),
+	),
+	decls.NewFunction("net.safe_ip_from_string",
+		decls.NewOverload("net_safe_ip_from_string_string", []*expr.Type{decls.String}, decls.Bytes),
+	),
+	decls.NewFunction("net.ip_to_string",
+		decls.NewOverload("net_ip_to_string_bytes", []*expr.Type{decls.Bytes}, decls.String),
+	),
+	decls.NewFunction("net.ip_net_mask",
+		decls.NewOverload("net_ip_net_mask_int_int", []*expr.Type{decls.Int, decls.Int}, decls.Bytes),
+	),
+	decls.NewFunction("net.ip_trunc",
+		decls.NewOverload("net_ip_trunc_bytes_int", []*expr.Type{decls.Bytes, decls.Int}, decls.Bytes),
+	),
+	decls.NewFunction("net.ipv4_from_int64",
+		decls.NewOverload("net_ipv4_from_int64_int", []*expr.Type{decls.Int}, decls.Bytes),
+	),
+	decls.NewFunction("net.ipv4_to_int64",
+		decls.NewOverload("net_ipv4_to_int64_bytes", []*expr.Type{decls.Bytes}, decls.Int),
+	),
+
 	// safe array indexing operators
 	// https://cloud.google.com/bigquery/docs/reference/standard-sql/operators#array_subscript_operator
 	decls.NewFunction("get",
@@ -357,6 +711,47 @@ var SQLTypeDeclarations = cel.Declarations(
 	decls.NewFunction("array_includes",
 		decls.NewInstanceOverload("array_includes", []*expr.Type{decls.NewListType(typeV), typeV}, decls.Bool),
 	),
+
+	// array functions
+	// https://cloud.google.com/bigquery/docs/reference/standard-sql/array_functions
+	decls.NewFunction("array_concat",
+		decls.NewParameterizedOverload("array_concat_list_list", []*expr.Type{listOfV, listOfV}, listOfV, []string{"V"}),
+		decls.NewParameterizedOverload("array_concat_list_list_list", []*expr.Type{listOfV, listOfV, listOfV}, listOfV, []string{"V"}),
+	),
+	decls.NewFunction("array_reverse",
+		decls.NewParameterizedOverload("array_reverse_list", []*expr.Type{listOfV}, listOfV, []string{"V"}),
+	),
+	decls.NewFunction("array_first",
+		decls.NewParameterizedOverload("array_first_list", []*expr.Type{listOfV}, typeV, []string{"V"}),
+	),
+	decls.NewFunction("array_last",
+		decls.NewParameterizedOverload("array_last_list", []*expr.Type{listOfV}, typeV, []string{"V"}),
+	),
+	decls.NewFunction("array_slice",
+		decls.NewParameterizedOverload("array_slice_list_int_int", []*expr.Type{listOfV, decls.Int, decls.Int}, listOfV, []string{"V"}),
+	),
+	decls.NewFunction("array_to_string",
+		decls.NewOverload("array_to_string_list_string", []*expr.Type{decls.NewListType(decls.String), decls.String}, decls.String),
+		decls.NewOverload("array_to_string_list_string_string", []*expr.Type{decls.NewListType(decls.String), decls.String, decls.String}, decls.String),
+	),
+	decls.NewFunction("generate_array",
+		decls.NewOverload("generate_array_int_int", []*expr.Type{decls.Int, decls.Int}, decls.NewListType(decls.Int)),
+		decls.NewOverload("generate_array_int_int_int", []*expr.Type{decls.Int, decls.Int, decls.Int}, decls.NewListType(decls.Int)),
+		decls.NewOverload("generate_array_double_double_double", []*expr.Type{decls.Double, decls.Double, decls.Double}, decls.NewListType(decls.Double)),
+	),
+	// list functions compatible with cel-go's ext.Lists()
+	decls.NewFunction("distinct",
+		decls.NewParameterizedInstanceOverload("list_distinct", []*expr.Type{listOfV}, listOfV, []string{"V"}),
+	),
+	decls.NewFunction("flatten",
+		decls.NewParameterizedInstanceOverload("list_flatten", []*expr.Type{decls.NewListType(listOfV)}, listOfV, []string{"V"}),
+	),
+	decls.NewFunction("slice",
+		decls.NewParameterizedInstanceOverload("list_slice", []*expr.Type{listOfV, decls.Int, decls.Int}, listOfV, []string{"V"}),
+	),
+	decls.NewFunction("lists.range",
+		decls.NewOverload("lists_range", []*expr.Type{decls.Int}, decls.NewListType(decls.Int)),
+	),
 )
 
 var AdditionalMacros = cel.Macros(
@@ -365,4 +760,99 @@ var AdditionalMacros = cel.Macros(
 	cel.NewReceiverMacro("array_transform", 2, parser.MakeMap),
 	cel.NewReceiverMacro("array_filter", 2, parser.MakeFilter),
 	cel.NewReceiverMacro("array_includes", 2, parser.MakeExists),
+	cel.NewGlobalVarArgMacro("case", makeCase),
+	cel.NewGlobalVarArgMacro("greatest", makeVarArgList("greatest", 2)),
+	cel.NewGlobalVarArgMacro("least", makeVarArgList("least", 2)),
+	cel.NewGlobalVarArgMacro("coalesce", makeVarArgList("coalesce", 1)),
+	cel.NewGlobalMacro(operators.Equals, 2, makeTemporalEquality(operators.Equals)),
+	cel.NewGlobalMacro(operators.NotEquals, 2, makeTemporalEquality(operators.NotEquals)),
 )
+
+// temporalLiteralPattern matches the beginning of ISO 8601 dates, date times, timestamps and times.
+var temporalLiteralPattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}|\d{2}:\d{2})`)
+
+// temporalConstructors are the functions which make temporal values from literals.
+var temporalConstructors = map[string]bool{
+	"date":                         true,
+	"datetime":                     true,
+	"time":                         true,
+	overloads.TypeConvertTimestamp: true,
+}
+
+// makeTemporalEquality wraps an operand of == or != which looks like a temporal literal in dyn(), like
+// event.day == dyn("2024-01-01"), since _==_ cannot be declared for operands of different types.
+// The checker accepts dyn() against any type and it evaluates to the literal itself,
+// while the converter coerces the literal into the type of the other operand.
+func makeTemporalEquality(function string) parser.MacroExpander {
+	return func(eh parser.ExprHelper, target *expr.Expr, args []*expr.Expr) (*expr.Expr, *common.Error) {
+		lhs, rhs := args[0], args[1]
+		switch {
+		case isTemporalLiteral(rhs):
+			rhs = eh.GlobalCall(overloads.TypeConvertDyn, rhs)
+		case isTemporalLiteral(lhs):
+			lhs = eh.GlobalCall(overloads.TypeConvertDyn, lhs)
+		default:
+			return nil, nil
+		}
+		return eh.GlobalCall(function, lhs, rhs), nil
+	}
+}
+
+func isTemporalLiteral(e *expr.Expr) bool {
+	if c := e.GetCallExpr(); c != nil {
+		return c.GetTarget() == nil && temporalConstructors[c.GetFunction()] && len(c.GetArgs()) > 0 &&
+			c.GetArgs()[0].GetConstExpr() != nil
+	}
+	str, ok := e.GetConstExpr().GetConstantKind().(*expr.Constant_StringValue)
+	return ok && temporalLiteralPattern.MatchString(str.StringValue)
+}
+
+// makeCase expands case(cond1, value1, cond2, value2, ..., default) into chained conditional operators.
+func makeCase(eh parser.ExprHelper, target *expr.Expr, args []*expr.Expr) (*expr.Expr, *common.Error) {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return nil, &common.Error{Message: "case() requires pairs of a condition and a value, followed by a default value"}
+	}
+	result := args[len(args)-1]
+	for i := len(args) - 3; i >= 0; i -= 2 {
+		result = eh.GlobalCall(operators.Conditional, args[i], args[i+1], result)
+	}
+	return result, nil
+}
+
+// makeVarArgList expands calls of function with at least minArgs arguments into a call with the list of them.
+func makeVarArgList(function string, minArgs int) parser.MacroExpander {
+	return func(eh parser.ExprHelper, target *expr.Expr, args []*expr.Expr) (*expr.Expr, *common.Error) {
+		if len(args) < minArgs {
+			return nil, nil
+		}
+		return eh.GlobalCall(function, eh.NewList(args...)), nil
+	}
+}
+
+// temporalComparableTypes are the pairs of types whose comparisons are coerced, named as in overload IDs.
+var temporalComparableTypes = []struct {
+	lhsName, rhsName string
+	lhs, rhs         *expr.Type
+}{
+	{"date", "datetime", Date, DateTime},
+	{"date", "timestamp", Date, decls.Timestamp},
+	{"datetime", "timestamp", DateTime, decls.Timestamp},
+	{"date", "string", Date, decls.String},
+	{"datetime", "string", DateTime, decls.String},
+	{"timestamp", "string", decls.Timestamp, decls.String},
+	{"time", "string", Time, decls.String},
+}
+
+// newTemporalComparison declares the comparison function between each pair of temporalComparableTypes in both orders.
+// Equality cannot be declared for them, since it would overlap with the overload of _==_ for any type,
+// so the macros of makeTemporalEquality let the checker accept it instead.
+func newTemporalComparison(function string, prefix string) *expr.Decl {
+	var comparisons []*expr.Decl_FunctionDecl_Overload
+	for _, t := range temporalComparableTypes {
+		comparisons = append(comparisons,
+			decls.NewOverload(prefix+"_"+t.lhsName+"_"+t.rhsName, []*expr.Type{t.lhs, t.rhs}, decls.Bool),
+			decls.NewOverload(prefix+"_"+t.rhsName+"_"+t.lhsName, []*expr.Type{t.rhs, t.lhs}, decls.Bool),
+		)
+	}
+	return decls.NewFunction(function, comparisons...)
+}
@@ -0,0 +1,319 @@
+package cel2sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/cel-go/common/operators"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// The functions of cel-go's ext.Strings() use 0-based indexes, while SQL string functions are 1-based.
+
+func (con *Converter) writeStringTarget(target *exprpb.Expr) error {
+	return con.visitMaybeNested(target, isBinaryOrTernaryOperator(target))
+}
+
+// writeOffset writes expr + delta, folding constant integers.
+func (con *Converter) writeOffset(expr *exprpb.Expr, delta int64) error {
+	if c, ok := expr.GetConstExpr().GetConstantKind().(*exprpb.Constant_Int64Value); ok {
+		con.str.WriteString(strconv.FormatInt(c.Int64Value+delta, 10))
+		return nil
+	}
+	if err := con.visitMaybeNested(expr, isComplexOperatorWithRespectTo(operators.Add, expr)); err != nil {
+		return err
+	}
+	if delta < 0 {
+		con.str.WriteString(" - ")
+		con.str.WriteString(strconv.FormatInt(-delta, 10))
+	} else {
+		con.str.WriteString(" + ")
+		con.str.WriteString(strconv.FormatInt(delta, 10))
+	}
+	return nil
+}
+
+// callCharAt converts s.charAt(i) into SUBSTR(s, i + 1, 1).
+func (con *Converter) callCharAt(target *exprpb.Expr, args []*exprpb.Expr) error {
+	con.str.WriteString("SUBSTR(")
+	if err := con.writeStringTarget(target); err != nil {
+		return err
+	}
+	con.str.WriteString(", ")
+	if err := con.writeOffset(args[0], 1); err != nil {
+		return err
+	}
+	con.str.WriteString(", 1)")
+	return nil
+}
+
+// callIndexOf converts s.indexOf(sub[, offset]) into STRPOS() or INSTR(), which return 0 when not found.
+func (con *Converter) callIndexOf(target *exprpb.Expr, args []*exprpb.Expr) error {
+	if len(args) == 1 {
+		con.str.WriteString("STRPOS(")
+	} else {
+		con.str.WriteString("INSTR(")
+	}
+	if err := con.writeStringTarget(target); err != nil {
+		return err
+	}
+	con.str.WriteString(", ")
+	if err := con.Visit(args[0]); err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		con.str.WriteString(", ")
+		if err := con.writeOffset(args[1], 1); err != nil {
+			return err
+		}
+	}
+	con.str.WriteString(") - 1")
+	return nil
+}
+
+// callLastIndexOf converts s.lastIndexOf(sub[, offset]) into INSTR() with a negative position,
+// which searches backwards from the end of s.
+func (con *Converter) callLastIndexOf(target *exprpb.Expr, args []*exprpb.Expr) error {
+	con.str.WriteString("INSTR(")
+	if err := con.writeStringTarget(target); err != nil {
+		return err
+	}
+	con.str.WriteString(", ")
+	if err := con.Visit(args[0]); err != nil {
+		return err
+	}
+	con.str.WriteString(", ")
+	if len(args) == 1 {
+		con.str.WriteString("-1")
+	} else {
+		if err := con.visitMaybeNested(args[1], isComplexOperatorWithRespectTo(operators.Subtract, args[1])); err != nil {
+			return err
+		}
+		con.str.WriteString(" - LENGTH(")
+		if err := con.Visit(target); err != nil {
+			return err
+		}
+		con.str.WriteString(")")
+	}
+	con.str.WriteString(") - 1")
+	return nil
+}
+
+// callSubstring converts s.substring(start[, end]) into SUBSTR(s, start + 1[, end - start]).
+func (con *Converter) callSubstring(target *exprpb.Expr, args []*exprpb.Expr) error {
+	con.str.WriteString("SUBSTR(")
+	if err := con.writeStringTarget(target); err != nil {
+		return err
+	}
+	con.str.WriteString(", ")
+	if err := con.writeOffset(args[0], 1); err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		con.str.WriteString(", ")
+		start, startOk := args[0].GetConstExpr().GetConstantKind().(*exprpb.Constant_Int64Value)
+		end, endOk := args[1].GetConstExpr().GetConstantKind().(*exprpb.Constant_Int64Value)
+		if startOk && endOk {
+			con.str.WriteString(strconv.FormatInt(end.Int64Value-start.Int64Value, 10))
+		} else {
+			if err := con.visitMaybeNested(args[1], isComplexOperatorWithRespectTo(operators.Subtract, args[1])); err != nil {
+				return err
+			}
+			con.str.WriteString(" - ")
+			nested := isComplexOperatorWithRespectTo(operators.Subtract, args[0]) || isSamePrecedence(operators.Subtract, args[0])
+			if err := con.visitMaybeNested(args[0], nested); err != nil {
+				return err
+			}
+		}
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+// callReplaceLimit converts s.replace(old, new, n), which replaces the first n occurrences, or all of them if n is negative.
+func (con *Converter) callReplaceLimit(target *exprpb.Expr, args []*exprpb.Expr) error {
+	n, ok := args[2].GetConstExpr().GetConstantKind().(*exprpb.Constant_Int64Value)
+	switch {
+	case ok && n.Int64Value < 0:
+		return con.callReplace(target, args[:2])
+	case ok && n.Int64Value == 0:
+		return con.Visit(target)
+	}
+	// join the parts split by old, with new between the first n + 1 parts and old after them.
+	// An empty string is split into no parts, which STRING_AGG aggregates into NULL, so it falls back to s.
+	con.str.WriteString("IFNULL((SELECT STRING_AGG(IF(_i = 0, _v, IF(")
+	if !ok {
+		if err := con.visitMaybeNested(args[2], isComplexOperatorWithRespectTo(operators.Less, args[2])); err != nil {
+			return err
+		}
+		con.str.WriteString(" < 0 OR ")
+	}
+	con.str.WriteString("_i <= ")
+	if err := con.visitMaybeNested(args[2], isComplexOperatorWithRespectTo(operators.LessEquals, args[2])); err != nil {
+		return err
+	}
+	con.str.WriteString(", ")
+	if err := con.Visit(args[1]); err != nil {
+		return err
+	}
+	con.str.WriteString(", ")
+	if err := con.Visit(args[0]); err != nil {
+		return err
+	}
+	con.str.WriteString(") || _v), \"\" ORDER BY _i) FROM UNNEST(SPLIT(")
+	if err := con.Visit(target); err != nil {
+		return err
+	}
+	con.str.WriteString(", ")
+	if err := con.Visit(args[0]); err != nil {
+		return err
+	}
+	con.str.WriteString(")) AS _v WITH OFFSET AS _i), ")
+	if err := con.Visit(target); err != nil {
+		return err
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+// callSplitLimit converts s.split(sep, n), which returns at most n parts, the last of them holding the remainder.
+func (con *Converter) callSplitLimit(target *exprpb.Expr, args []*exprpb.Expr) error {
+	n, ok := args[1].GetConstExpr().GetConstantKind().(*exprpb.Constant_Int64Value)
+	if !ok {
+		return fmt.Errorf("split() limit must be a constant")
+	}
+	switch {
+	case n.Int64Value < 0:
+		con.str.WriteString("SPLIT(")
+	case n.Int64Value == 0:
+		con.str.WriteString("[]")
+		return nil
+	case n.Int64Value == 1:
+		con.str.WriteString("[")
+		if err := con.Visit(target); err != nil {
+			return err
+		}
+		con.str.WriteString("]")
+		return nil
+	default:
+		con.str.WriteString("ARRAY(SELECT STRING_AGG(_v, ")
+		if err := con.Visit(args[0]); err != nil {
+			return err
+		}
+		con.str.WriteString(" ORDER BY _i) FROM UNNEST(SPLIT(")
+	}
+	if err := con.Visit(target); err != nil {
+		return err
+	}
+	con.str.WriteString(", ")
+	if err := con.Visit(args[0]); err != nil {
+		return err
+	}
+	if n.Int64Value < 0 {
+		con.str.WriteString(")")
+		return nil
+	}
+	last := strconv.FormatInt(n.Int64Value-1, 10)
+	con.str.WriteString(")) AS _v WITH OFFSET AS _i GROUP BY LEAST(_i, ")
+	con.str.WriteString(last)
+	con.str.WriteString(") ORDER BY MIN(_i))")
+	return nil
+}
+
+// callJoin converts list.join([sep]) into ARRAY_TO_STRING().
+func (con *Converter) callJoin(target *exprpb.Expr, args []*exprpb.Expr) error {
+	con.str.WriteString("ARRAY_TO_STRING(")
+	if err := con.writeStringTarget(target); err != nil {
+		return err
+	}
+	con.str.WriteString(", ")
+	if len(args) == 0 {
+		con.str.WriteString(`""`)
+	} else if err := con.Visit(args[0]); err != nil {
+		return err
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+// callQuote converts strings.quote(s) into a double quoted string literal.
+func (con *Converter) callQuote(args []*exprpb.Expr) error {
+	con.str.WriteString(`FORMAT("%T", `)
+	if err := con.Visit(args[0]); err != nil {
+		return err
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+// callFormat converts "...".format([args]) into FORMAT().
+// The format string must be constant, and the arguments must be a list literal.
+func (con *Converter) callFormat(target *exprpb.Expr, args []*exprpb.Expr) error {
+	if !isStringLiteral(target) {
+		return fmt.Errorf("format() target must be a string literal")
+	}
+	list := args[0].GetListExpr()
+	if list == nil {
+		return fmt.Errorf("format() argument must be a list literal")
+	}
+	format, err := con.formatString(target.GetConstExpr().GetStringValue(), list.GetElements())
+	if err != nil {
+		return err
+	}
+	con.str.WriteString("FORMAT(")
+	con.WriteValue(format)
+	for _, arg := range list.GetElements() {
+		con.str.WriteString(", ")
+		if err := con.Visit(arg); err != nil {
+			return err
+		}
+	}
+	con.str.WriteString(")")
+	return nil
+}
+
+// formatString translates the verbs of CEL's format() into those of BigQuery's FORMAT().
+func (con *Converter) formatString(format string, args []*exprpb.Expr) (string, error) {
+	var sb strings.Builder
+	argIndex := 0
+	for i := 0; i < len(format); i++ {
+		ch := format[i]
+		sb.WriteByte(ch)
+		if ch != '%' {
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			sb.WriteByte('%')
+			continue
+		}
+		// precision like %.3f
+		for i < len(format) && (format[i] == '.' || ('0' <= format[i] && format[i] <= '9')) {
+			sb.WriteByte(format[i])
+			i++
+		}
+		if i >= len(format) {
+			return "", fmt.Errorf("format() string ends with an incomplete verb: %q", format)
+		}
+		if argIndex >= len(args) {
+			return "", fmt.Errorf("format() has fewer arguments than verbs: %q", format)
+		}
+		verb := format[i]
+		switch verb {
+		case 's':
+			if !IsStringType(con.GetType(args[argIndex])) {
+				verb = 't'
+			}
+		case 'd', 'f', 'e', 'x', 'X', 'o':
+		default:
+			return "", fmt.Errorf("unsupported format() verb %%%c", verb)
+		}
+		sb.WriteByte(verb)
+		argIndex++
+	}
+	if argIndex != len(args) {
+		return "", fmt.Errorf("format() has more arguments than verbs: %q", format)
+	}
+	return sb.String(), nil
+}